@@ -0,0 +1,334 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+const defaultBatchParallel = 4
+
+// batchJob is one partition job of the jobs file. Empty values default to the
+// command line flags.
+type batchJob struct {
+	Name          string `yaml:"name"`
+	Profile       string `yaml:"profile"`
+	Bucket        string `yaml:"bucket"`
+	Prefix        string `yaml:"prefix"`
+	TimestampFrom string `yaml:"timestamp-from"`
+	TimestampTo   string `yaml:"timestamp-to"`
+	Duration      string `yaml:"duration"`
+}
+
+type batchFile struct {
+	Jobs []batchJob `yaml:"jobs"`
+}
+
+type batchResult struct {
+	Job     batchJob
+	Config  partitionConfig
+	Metrics metrics
+	Err     error
+}
+
+// batch subcommand
+var batchCmd = &cobra.Command{
+	Use:   "batch",
+	Short: "Initiate partitioning of several buckets/accounts from a jobs file",
+	Long: `Run several partition jobs concurrently, each job having its own profile, bucket,
+prefix and time window, and print a combined summary.
+
+The jobs file is a yaml file, job values not set default to the command line flags:
+
+	jobs:
+	  - name: dev
+	    profile: swisstopo-bgdi-dev
+	    bucket: swisstopo-bgdi-dev-cloudfront-logs-v2
+	    prefix: sys-data.dev.bgdi.ch
+	    timestamp-from: 2025-04-25
+	    duration: 1d
+	  - name: prod
+	    profile: swisstopo-bgdi
+	    bucket: swisstopo-bgdi-cloudfront-logs-v2
+	    timestamp-from: yesterday
+	    timestamp-to: today
+
+Examples:
+	cloudfront-logs batch --jobs-file jobs.yaml --dry-run --verbose
+`,
+	Args: cobra.ExactArgs(0),
+	PreRun: func(cmd *cobra.Command, _ []string) {
+		// --profile and --bucket are set per job
+		unmarkRequiredFlags(cmd, "profile", "bucket")
+	},
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		timeStart := time.Now()
+
+		jobs, err := readBatchFile(cmd.Flag("jobs-file").Value.String())
+		if err != nil {
+			return err
+		}
+
+		parallel, err := cmd.Flags().GetInt("parallel")
+		if err != nil {
+			return err
+		}
+
+		// Build all configs first to report configuration errors before doing any work
+		results, err := newBatchResults(cmd, jobs)
+		if err != nil {
+			return err
+		}
+
+		lineSeparator := strings.Repeat("-", numberOfSeparatorChars)
+		fmt.Println(lineSeparator)
+		fmt.Printf("%s - Cloudfront logs batch partitioning of %d jobs starting\n",
+			timeStart.Format("2006-01-02 15:04:05"), len(results))
+		fmt.Println(lineSeparator)
+
+		stateFile := cmd.Flag("state-file").Value.String()
+		var state *StateStore
+		if stateFile != "" {
+			state, err = NewStateStore(stateFile)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = state.Close() }()
+		}
+
+		for _, result := range results {
+			if result.Config.SkipPreflight {
+				continue
+			}
+			fmt.Printf("Pre-flight checks of job %s:\n", result.Job.Name)
+			err = runPreflight(context.Background(), result.Config)
+			if err != nil {
+				return fmt.Errorf("job %s: %w", result.Job.Name, err)
+			}
+		}
+
+		runBatch(results, parallel, func(result *batchResult) { runBatchJob(result, state) })
+
+		printBatchEnd(results, time.Since(timeStart))
+
+		return batchError(results)
+	},
+}
+
+//-----------------------------------------------------------------------------
+
+func init() {
+	rootCmd.AddCommand(batchCmd)
+
+	addPartitionFlags(batchCmd)
+	batchCmd.Flags().String("jobs-file", "", "Yaml file with the list of partition jobs")
+	batchCmd.Flags().IntP("parallel", "j", defaultBatchParallel, "Number of jobs run in parallel")
+
+	_ = batchCmd.MarkFlagRequired("jobs-file")
+}
+
+//-----------------------------------------------------------------------------
+
+func readBatchFile(filename string) ([]batchJob, error) {
+	d, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var f batchFile
+	err = yaml.Unmarshal(d, &f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read jobs file %s: %w", filename, err)
+	}
+	if len(f.Jobs) == 0 {
+		return nil, fmt.Errorf("no jobs found in %s", filename)
+	}
+
+	for i := range f.Jobs {
+		if f.Jobs[i].Name == "" {
+			f.Jobs[i].Name = fmt.Sprintf("job-%d", i+1)
+		}
+	}
+
+	return f.Jobs, nil
+}
+
+// Returns one result per job with the partition config of the job. The config is
+// built from a copy of the command flags overridden with the job values, the command
+// flags are not modified.
+func newBatchResults(cmd *cobra.Command, jobs []batchJob) ([]*batchResult, error) {
+	defaults := batchJob{
+		Profile:       cmd.Flag("profile").Value.String(),
+		Bucket:        cmd.Flag("bucket").Value.String(),
+		Prefix:        cmd.Flag("prefix").Value.String(),
+		TimestampFrom: cmd.Flag("timestamp-from").Value.String(),
+		TimestampTo:   cmd.Flag("timestamp-to").Value.String(),
+		Duration:      cmd.Flag("duration").Value.String(),
+	}
+
+	// Config of the flags not set per job
+	base, err := newS3Config(cmd)
+	if err != nil {
+		return nil, err
+	}
+	err = setTimeZone(cmd, &base)
+	if err != nil {
+		return nil, err
+	}
+	err = setPartitionOptions(cmd, &base)
+	if err != nil {
+		return nil, err
+	}
+	queueURL := cmd.Flag("sqs-queue-url").Value.String()
+
+	now := time.Now()
+	results := []*batchResult{}
+	for _, job := range jobs {
+		var conf partitionConfig
+		conf, err = newBatchJobConfig(base, mergeBatchJob(defaults, job), queueURL, now)
+		if err != nil {
+			return nil, fmt.Errorf("job %s: %w", job.Name, err)
+		}
+		results = append(results, &batchResult{Job: job, Config: conf})
+	}
+
+	return results, nil
+}
+
+// Returns the job with the empty values set to the defaults
+func mergeBatchJob(defaults, job batchJob) batchJob {
+	merged := defaults
+	merged.Name = job.Name
+	if job.Profile != "" {
+		merged.Profile = job.Profile
+	}
+	if job.Bucket != "" {
+		merged.Bucket = job.Bucket
+	}
+	if job.Prefix != "" {
+		merged.Prefix = job.Prefix
+	}
+	if job.TimestampFrom != "" {
+		merged.TimestampFrom = job.TimestampFrom
+	}
+	if job.TimestampTo != "" || job.Duration != "" {
+		// The job window end overrides both flags
+		merged.TimestampTo = job.TimestampTo
+		merged.Duration = job.Duration
+	}
+	return merged
+}
+
+// Returns the config of the job from a copy of the base config, the queue is the one of
+// the job profile if queueURL is empty.
+func newBatchJobConfig(base partitionConfig, job batchJob, queueURL string, now time.Time) (partitionConfig, error) {
+	conf := base
+	if job.Bucket == "" {
+		return conf, errors.New("no bucket")
+	}
+	conf.AwsProfile = job.Profile
+	conf.S3Bucket = job.Bucket
+	conf.S3Prefix = job.Prefix
+
+	var err error
+	conf.SqsQueueURL = queueURL
+	if conf.SqsQueueURL == "" {
+		conf.SqsQueueURL, err = sqsQueueURL(job.Profile)
+		if err != nil {
+			return conf, err
+		}
+	}
+
+	conf.TimeFrom, conf.TimeTo, err = parseTimeWindow(job.TimestampFrom, job.TimestampTo, job.Duration, now, conf.TimeZone)
+	return conf, err
+}
+
+// Runs the jobs with run, at most workers jobs concurrently. run sets the metrics and the
+// error of the job result.
+func runBatch(results []*batchResult, workers int, run func(*batchResult)) {
+	var wg sync.WaitGroup
+	taskChan := make(chan *batchResult, len(results)) // Buffered channel for tasks
+
+	// Start worker goroutines
+	for range max(workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for result := range taskChan { // Process tasks from channel
+				run(result)
+			}
+		}()
+	}
+
+	// Send tasks to workers
+	for _, result := range results {
+		taskChan <- result
+	}
+	close(taskChan) // Close channel to signal workers no more tasks are coming
+
+	// Wait for all workers to finish
+	wg.Wait()
+}
+
+// Returns an error if some jobs failed
+func batchError(results []*batchResult) error {
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d/%d batch jobs failed", failed, len(results))
+	}
+	return nil
+}
+
+func runBatchJob(result *batchResult, state *StateStore) {
+	timeStart := time.Now()
+	fmt.Printf("%s - Job %s started (%s, s3://%s/%s, %s)\n",
+		timeStart.Format("2006-01-02 15:04:05"),
+		result.Job.Name,
+		result.Config.AwsProfile,
+		result.Config.S3Bucket,
+		result.Config.S3Prefix,
+		formatTimeWindow(result.Config.TimeFrom, result.Config.TimeTo),
+	)
+
+	// Collect metrics, the progress is not printed as jobs run concurrently
+	ch := make(chan metrics)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		result.Metrics = collectMetrics(ch, timeStart, false)
+		wg.Done()
+	}()
+
+	result.Err = runPartition(context.Background(), result.Config, state, ch)
+
+	close(ch)
+	wg.Wait()
+	result.Metrics.Durations.Total = time.Since(timeStart)
+
+	if result.Err != nil {
+		fmt.Printf("%s - Job %s failed after %s: %s\n",
+			time.Now().Format("2006-01-02 15:04:05"),
+			result.Job.Name,
+			result.Metrics.Durations.Total.Round(time.Millisecond),
+			result.Err,
+		)
+		return
+	}
+	fmt.Printf("%s - Job %s done in %s\n",
+		time.Now().Format("2006-01-02 15:04:05"),
+		result.Job.Name,
+		result.Metrics.Durations.Total.Round(time.Millisecond),
+	)
+}
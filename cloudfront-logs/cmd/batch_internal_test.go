@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const devQueueURL = "https://sqs.eu-central-1.amazonaws.com/839910802816/cloudfront-logs-partitioning-queue-manual"
+
+func writeBatchFile(t *testing.T, content string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "jobs.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte(content), 0o600))
+	return filename
+}
+
+func TestReadBatchFile(t *testing.T) {
+	jobs, err := readBatchFile(writeBatchFile(t, `
+jobs:
+  - name: dev
+    profile: swisstopo-bgdi-dev
+    bucket: dev-bucket
+    prefix: sys-data.dev.bgdi.ch
+    timestamp-from: 2025-04-25
+    duration: 1d
+  - bucket: other-bucket
+    timestamp-to: today
+`))
+	require.NoError(t, err)
+	require.Len(t, jobs, 2)
+	assert.Equal(t, batchJob{
+		Name:          "dev",
+		Profile:       "swisstopo-bgdi-dev",
+		Bucket:        "dev-bucket",
+		Prefix:        "sys-data.dev.bgdi.ch",
+		TimestampFrom: "2025-04-25",
+		Duration:      "1d",
+	}, jobs[0])
+	assert.Equal(t, batchJob{Name: "job-2", Bucket: "other-bucket", TimestampTo: "today"}, jobs[1])
+
+	_, err = readBatchFile(writeBatchFile(t, "jobs: []\n"))
+	require.ErrorContains(t, err, "no jobs found")
+	_, err = readBatchFile(writeBatchFile(t, "jobs: [\n"))
+	require.ErrorContains(t, err, "failed to read jobs file")
+	_, err = readBatchFile(filepath.Join(t.TempDir(), "missing.yaml"))
+	require.Error(t, err)
+}
+
+func TestMergeBatchJob(t *testing.T) {
+	defaults := batchJob{
+		Profile:       "swisstopo-bgdi-dev",
+		Bucket:        "default-bucket",
+		Prefix:        "a.ch",
+		TimestampFrom: "2025-04-25",
+		TimestampTo:   "2025-04-27",
+	}
+
+	// Empty values default to the flags
+	assert.Equal(t, batchJob{
+		Name:          "job",
+		Profile:       "swisstopo-bgdi-dev",
+		Bucket:        "bucket",
+		Prefix:        "a.ch",
+		TimestampFrom: "2025-04-25",
+		TimestampTo:   "2025-04-27",
+	}, mergeBatchJob(defaults, batchJob{Name: "job", Bucket: "bucket"}))
+
+	// The job duration replaces the --timestamp-to flag
+	merged := mergeBatchJob(defaults, batchJob{Name: "job", TimestampFrom: "2025-04-26", Duration: "1d"})
+	assert.Equal(t, "2025-04-26", merged.TimestampFrom)
+	assert.Empty(t, merged.TimestampTo)
+	assert.Equal(t, "1d", merged.Duration)
+}
+
+func TestNewBatchResults(t *testing.T) {
+	cmd := &cobra.Command{}
+	addRootFlags(cmd)
+	addPartitionFlags(cmd)
+	require.NoError(t, cmd.ParseFlags([]string{
+		"--profile", "swisstopo-bgdi-dev", "--prefix", "a.ch", "--timestamp-from", "2025-04-25", "--dry-run",
+	}))
+
+	jobs := []batchJob{
+		{Name: "first", Bucket: "first-bucket", Prefix: "b.ch", Duration: "1d"},
+		{Name: "second", Profile: "swisstopo-bgdi", Bucket: "second-bucket", TimestampTo: "2025-04-28"},
+	}
+	results, err := newBatchResults(cmd, jobs)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+
+	first := results[0].Config
+	assert.Equal(t, "swisstopo-bgdi-dev", first.AwsProfile)
+	assert.Equal(t, devQueueURL, first.SqsQueueURL)
+	assert.Equal(t, "first-bucket", first.S3Bucket)
+	assert.Equal(t, "b.ch", first.S3Prefix)
+	assert.Equal(t, time.Date(2025, 4, 26, 0, 0, 0, 0, time.UTC), first.TimeTo)
+	assert.True(t, first.DryRun)
+
+	// The values of the first job don't leak into the second one
+	second := results[1].Config
+	assert.Equal(t, "swisstopo-bgdi", second.AwsProfile)
+	assert.NotEqual(t, devQueueURL, second.SqsQueueURL)
+	assert.Equal(t, "a.ch", second.S3Prefix)
+	assert.Equal(t, time.Date(2025, 4, 25, 0, 0, 0, 0, time.UTC), second.TimeFrom)
+	assert.Equal(t, time.Date(2025, 4, 28, 0, 0, 0, 0, time.UTC), second.TimeTo)
+	assert.True(t, second.DryRun)
+
+	// The command flags are not modified
+	assert.Empty(t, cmd.Flag("bucket").Value.String())
+	assert.Equal(t, "a.ch", cmd.Flag("prefix").Value.String())
+	assert.Empty(t, cmd.Flag("duration").Value.String())
+
+	// Invalid jobs
+	for _, job := range []batchJob{
+		{Name: "no-bucket"},
+		{Name: "invalid-profile", Profile: "unknown", Bucket: "bucket"},
+		{Name: "invalid-window", Bucket: "bucket", TimestampTo: "2025-04-24"},
+		{Name: "invalid-duration", Bucket: "bucket", Duration: "1x"},
+	} {
+		_, err = newBatchResults(cmd, []batchJob{jobs[0], job})
+		require.ErrorContains(t, err, "job "+job.Name+":")
+	}
+}
+
+func TestRunBatch(t *testing.T) {
+	results := []*batchResult{}
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		results = append(results, &batchResult{Job: batchJob{Name: name}})
+	}
+
+	var running, maxRunning atomic.Int32
+	var mutex sync.Mutex
+	done := []string{}
+	runBatch(results, 2, func(result *batchResult) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			m := maxRunning.Load()
+			if n <= m || maxRunning.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		result.Metrics.Counters.Files.Partitioned = 1
+		if result.Job.Name == "c" {
+			result.Err = errors.New("failed")
+		}
+		mutex.Lock()
+		done = append(done, result.Job.Name)
+		mutex.Unlock()
+	})
+
+	assert.Len(t, done, len(results))
+	assert.LessOrEqual(t, maxRunning.Load(), int32(2))
+	for _, result := range results {
+		assert.Equal(t, 1, int(result.Metrics.Counters.Files.Partitioned), result.Job.Name)
+	}
+	require.EqualError(t, batchError(results), "1/5 batch jobs failed")
+	require.NoError(t, batchError(results[:2]))
+}
@@ -1,15 +1,25 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/geoadmin/tool-golang-bgdi/lib/awscfg"
 	"github.com/spf13/cobra"
 )
 
 type partitionConfig struct {
 	AwsProfile        string
 	AwsRegion         string
+	AwsNoProfile      bool
+	AwsRoleArn        string
+	AwsExternalID     string
+	AwsWebIdentity    string
 	S3Bucket          string
 	S3Prefix          string
 	S3ObjectDelimiter string
@@ -17,71 +27,141 @@ type partitionConfig struct {
 	SqsQueueURL       string
 	SqsMessageRecords int
 	SqsBatchSize      int
+	SqsFifo           bool
+	SqsContentDedup   bool
+	SqsGroupBy        string
+	SqsDeduplication  string
+	TimeZone          *time.Location
 	TimeFrom          time.Time
 	TimeTo            time.Time
+	MinSize           int64
+	MaxSize           int64
+	ModifiedSince     time.Time
+	ModifiedBefore    time.Time
+	ExcludedClasses   []string
+	SampleFraction    float64
+	ShardIndex        int
+	ShardCount        int
+	Limit             int
+	StateFile         string
+	Force             bool
+	SkipPreflight     bool
 	DryRun            bool
 	Verbose           bool
 }
 
 func newPartionConfig(cmd *cobra.Command) (partitionConfig, error) {
-	conf := partitionConfig{}
-	conf.AwsProfile = cmd.Flag("profile").Value.String()
-	conf.AwsRegion = "eu-central-1"
-	conf.S3Bucket = cmd.Flag("bucket").Value.String()
+	conf, err := newBaseConfig(cmd)
+	if err != nil {
+		return conf, err
+	}
 	conf.S3Prefix = cmd.Flag("prefix").Value.String()
-	conf.S3MaxKeys = 0
 
-	switch conf.AwsProfile {
-	case "swisstopo-bgdi-dev":
-		conf.SqsQueueURL = "https://sqs.eu-central-1.amazonaws.com/839910802816/cloudfront-logs-partitioning-queue-manual"
-	case "swisstopo-bgdi":
-		conf.SqsQueueURL = "https://sqs.eu-central-1.amazonaws.com/993448060988/cloudfront-logs-partitioning-queue-manual"
-	default:
-		return conf, fmt.Errorf("invalid aws-profile %s. See --help for allowed values", conf.AwsProfile)
+	err = setTimeWindow(cmd, &conf)
+	if err != nil {
+		return conf, err
 	}
 
-	if len(cmd.Flag("timestamp-from").Value.String()) > 0 {
-		timeFrom, err := parseTimestamp(cmd.Flag("timestamp-from").Value.String())
-		if err != nil {
-			return conf, err
-		}
-		conf.TimeFrom = timeFrom
+	err = setPartitionOptions(cmd, &conf)
+	return conf, err
+}
+
+// Sets the partition flags that don't depend on the account, bucket, prefix and time window,
+// the time zone must be set.
+func setPartitionOptions(cmd *cobra.Command, conf *partitionConfig) error {
+	conf.S3MaxKeys = 0
+
+	err := setObjectFilters(cmd, conf)
+	if err != nil {
+		return err
 	}
 
-	if len(cmd.Flag("timestamp-to").Value.String()) > 0 {
-		timeTo, err := parseTimestamp(cmd.Flag("timestamp-to").Value.String())
-		if err != nil {
-			return conf, err
-		}
-		conf.TimeTo = timeTo
+	err = setSampling(cmd, conf)
+	if err != nil {
+		return err
 	}
 
 	messageRecords, err := cmd.Flags().GetInt64("sqs-message-records")
 	if err != nil {
-		return conf, err
+		return err
 	}
 	if messageRecords > maxSqsMessageRecords {
-		return conf, fmt.Errorf("sqs batch size %d too big. Max sqs batch size=10", messageRecords)
+		return fmt.Errorf("sqs batch size %d too big. Max sqs batch size=10", messageRecords)
 	}
 	conf.SqsMessageRecords = int(messageRecords)
 
 	batchSize, err := cmd.Flags().GetInt64("sqs-batch-size")
 
 	if err != nil {
-		return conf, err
+		return err
 	}
 	if batchSize > maxSqsBatchSize {
-		return conf, fmt.Errorf("sqs batch size %d too big. Max sqs batch size=10", batchSize)
+		return fmt.Errorf("sqs batch size %d too big. Max sqs batch size=10", batchSize)
 	}
 	conf.SqsBatchSize = int(batchSize)
 
+	err = setSqsFifoConfig(cmd, conf)
+	if err != nil {
+		return err
+	}
+
+	conf.StateFile = cmd.Flag("state-file").Value.String()
+
+	force, err := cmd.Flags().GetBool("force")
+	if err != nil {
+		return err
+	}
+	conf.Force = force
+
+	skipPreflight, err := cmd.Flags().GetBool("skip-preflight")
+	if err != nil {
+		return err
+	}
+	conf.SkipPreflight = skipPreflight
+
 	dryRun, err := cmd.Flags().GetBool("dry-run")
 
 	if err != nil {
-		return conf, err
+		return err
 	}
 	conf.DryRun = dryRun
 
+	return nil
+}
+
+// Returns the config from the root command flags (aws account, bucket and queue) for the
+// commands that don't partition.
+func newBaseConfig(cmd *cobra.Command) (partitionConfig, error) {
+	conf, err := newS3Config(cmd)
+	if err != nil {
+		return conf, err
+	}
+
+	queueURL := cmd.Flag("sqs-queue-url").Value.String()
+	if queueURL == "" {
+		queueURL, err = sqsQueueURL(conf.AwsProfile)
+		if err != nil {
+			return conf, err
+		}
+	}
+	conf.SqsQueueURL = queueURL
+
+	return conf, nil
+}
+
+// Returns the config from the root command flags without the queue (aws account and bucket)
+// for the commands only reading the bucket, they work with any aws profile.
+func newS3Config(cmd *cobra.Command) (partitionConfig, error) {
+	conf := partitionConfig{}
+	conf.AwsProfile = cmd.Flag("profile").Value.String()
+	conf.AwsRegion = "eu-central-1"
+	conf.S3Bucket = cmd.Flag("bucket").Value.String()
+
+	err := setAwsCredentials(cmd, &conf)
+	if err != nil {
+		return conf, err
+	}
+
 	verbose, err := cmd.Flags().GetBool("verbose")
 
 	if err != nil {
@@ -91,3 +171,221 @@ func newPartionConfig(cmd *cobra.Command) (partitionConfig, error) {
 
 	return conf, nil
 }
+
+// Returns the manual partitioning queue of the aws profile
+func sqsQueueURL(profile string) (string, error) {
+	switch profile {
+	case "swisstopo-bgdi-dev":
+		return "https://sqs.eu-central-1.amazonaws.com/839910802816/cloudfront-logs-partitioning-queue-manual", nil
+	case "swisstopo-bgdi":
+		return "https://sqs.eu-central-1.amazonaws.com/993448060988/cloudfront-logs-partitioning-queue-manual", nil
+	default:
+		return "", fmt.Errorf("invalid aws-profile %s. See --help for allowed values", profile)
+	}
+}
+
+func setSqsFifoConfig(cmd *cobra.Command, conf *partitionConfig) error {
+	conf.SqsGroupBy = cmd.Flag("sqs-group-by").Value.String()
+	switch conf.SqsGroupBy {
+	case sqsGroupByPrefix, sqsGroupByHour, sqsGroupByPrefixHour, sqsGroupByBucket:
+	default:
+		return fmt.Errorf("invalid --sqs-group-by %s. See --help for allowed values", conf.SqsGroupBy)
+	}
+
+	conf.SqsDeduplication = cmd.Flag("sqs-deduplication").Value.String()
+	switch conf.SqsDeduplication {
+	case sqsDeduplicationKeyHash, sqsDeduplicationContent:
+	default:
+		return fmt.Errorf("invalid --sqs-deduplication %s. See --help for allowed values", conf.SqsDeduplication)
+	}
+	return nil
+}
+
+func setAwsCredentials(cmd *cobra.Command, conf *partitionConfig) error {
+	noProfile, err := cmd.Flags().GetBool("no-profile")
+	if err != nil {
+		return err
+	}
+	conf.AwsNoProfile = noProfile
+	conf.AwsRoleArn = cmd.Flag("role-arn").Value.String()
+	conf.AwsExternalID = cmd.Flag("external-id").Value.String()
+	conf.AwsWebIdentity = cmd.Flag("web-identity-token-file").Value.String()
+	return awsOptions(*conf).Validate()
+}
+
+// Returns the AWS config with the credentials of the partition config
+func newAwsConfig(ctx context.Context, conf partitionConfig) (aws.Config, error) {
+	return awscfg.LoadConfig(ctx, awsOptions(conf))
+}
+
+func awsOptions(conf partitionConfig) awscfg.Options {
+	return awscfg.Options{
+		Region:               conf.AwsRegion,
+		Profile:              conf.AwsProfile,
+		NoProfile:            conf.AwsNoProfile,
+		RoleArn:              conf.AwsRoleArn,
+		ExternalID:           conf.AwsExternalID,
+		WebIdentityTokenFile: conf.AwsWebIdentity,
+		RoleSessionName:      fmt.Sprintf("ToolCloudfrontLogs%d", time.Now().Unix()),
+	}
+}
+
+func setTimeWindow(cmd *cobra.Command, conf *partitionConfig) error {
+	err := setTimeZone(cmd, conf)
+	if err != nil {
+		return err
+	}
+
+	conf.TimeFrom, conf.TimeTo, err = parseTimeWindow(
+		cmd.Flag("timestamp-from").Value.String(),
+		cmd.Flag("timestamp-to").Value.String(),
+		cmd.Flag("duration").Value.String(),
+		time.Now(),
+		conf.TimeZone,
+	)
+	return err
+}
+
+func setTimeZone(cmd *cobra.Command, conf *partitionConfig) error {
+	loc, err := time.LoadLocation(cmd.Flag("timezone").Value.String())
+	if err != nil {
+		return fmt.Errorf("invalid --timezone: %w", err)
+	}
+	conf.TimeZone = loc
+	return nil
+}
+
+// Returns the UTC time window [from, to) from the --timestamp-from, --timestamp-to and
+// --duration values. Empty values are open bounds.
+func parseTimeWindow(from, to, duration string, now time.Time, loc *time.Location) (time.Time, time.Time, error) {
+	var timeFrom, timeTo time.Time
+	var err error
+
+	if len(from) > 0 {
+		timeFrom, err = parseTimeExpression(from, now, loc)
+		if err != nil {
+			return timeFrom, timeTo, err
+		}
+	}
+
+	switch {
+	case len(to) > 0 && len(duration) > 0:
+		return timeFrom, timeTo, errors.New("--timestamp-to and --duration are mutually exclusive")
+	case len(to) > 0:
+		timeTo, err = parseTimeExpression(to, now, loc)
+		if err != nil {
+			return timeFrom, timeTo, err
+		}
+	case len(duration) > 0:
+		if timeFrom.IsZero() {
+			return timeFrom, timeTo, errors.New("--duration requires --timestamp-from")
+		}
+		d, e := parseDuration(duration)
+		if e != nil {
+			return timeFrom, timeTo, fmt.Errorf("invalid --duration %s: %w", duration, e)
+		}
+		timeTo = timeFrom.Add(d)
+	}
+
+	if !timeFrom.IsZero() && !timeTo.IsZero() && !timeFrom.Before(timeTo) {
+		return timeFrom, timeTo, fmt.Errorf("invalid time window: --timestamp-from %s must be before --timestamp-to %s",
+			timeFrom.Format(time.RFC3339), timeTo.Format(time.RFC3339))
+	}
+
+	return timeFrom, timeTo, nil
+}
+
+func setObjectFilters(cmd *cobra.Command, conf *partitionConfig) error {
+	now := time.Now()
+
+	minSize, err := cmd.Flags().GetInt64("min-size")
+	if err != nil {
+		return err
+	}
+	conf.MinSize = minSize
+
+	maxSize, err := cmd.Flags().GetInt64("max-size")
+	if err != nil {
+		return err
+	}
+	if maxSize > 0 && maxSize < minSize {
+		return fmt.Errorf("invalid --max-size %d, must be greater than --min-size %d", maxSize, minSize)
+	}
+	conf.MaxSize = maxSize
+
+	if len(cmd.Flag("modified-since").Value.String()) > 0 {
+		conf.ModifiedSince, err = parseTimeInstant(cmd.Flag("modified-since").Value.String(), now, conf.TimeZone)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(cmd.Flag("modified-before").Value.String()) > 0 {
+		conf.ModifiedBefore, err = parseTimeInstant(cmd.Flag("modified-before").Value.String(), now, conf.TimeZone)
+		if err != nil {
+			return err
+		}
+	}
+
+	excluded, err := cmd.Flags().GetStringSlice("exclude-storage-class")
+	if err != nil {
+		return err
+	}
+	conf.ExcludedClasses = []string{}
+	for _, class := range excluded {
+		conf.ExcludedClasses = append(conf.ExcludedClasses, strings.ToUpper(class))
+	}
+
+	return nil
+}
+
+func setSampling(cmd *cobra.Command, conf *partitionConfig) error {
+	sample, err := cmd.Flags().GetFloat64("sample")
+	if err != nil {
+		return err
+	}
+	if sample <= 0 || sample > 1 {
+		return fmt.Errorf("invalid --sample %g, must be in ]0, 1]", sample)
+	}
+	conf.SampleFraction = sample
+
+	conf.ShardIndex, conf.ShardCount, err = parseShard(cmd.Flag("shard").Value.String())
+	if err != nil {
+		return err
+	}
+
+	limit, err := cmd.Flags().GetInt("limit")
+	if err != nil {
+		return err
+	}
+	if limit < 0 {
+		return fmt.Errorf("invalid --limit %d, must be positive", limit)
+	}
+	conf.Limit = limit
+
+	return nil
+}
+
+// Returns the shard index and count of a "i/n" shard expression with 1 <= i <= n.
+// An empty expression is the single shard 1/1.
+func parseShard(shard string) (int, int, error) {
+	if shard == "" {
+		return 1, 1, nil
+	}
+	index, count, found := strings.Cut(shard, "/")
+	if !found {
+		return 0, 0, fmt.Errorf("invalid --shard %s, expected format i/n", shard)
+	}
+	i, err := strconv.Atoi(index)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid --shard %s: %w", shard, err)
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid --shard %s: %w", shard, err)
+	}
+	if n < 1 || i < 1 || i > n {
+		return 0, 0, fmt.Errorf("invalid --shard %s, expected 1 <= i <= n", shard)
+	}
+	return i, n, nil
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetAwsCredentials(t *testing.T) {
+	for _, tc := range []struct {
+		args  []string
+		valid bool
+	}{
+		{[]string{}, true},
+		{[]string{"--no-profile"}, true},
+		{[]string{"--role-arn", "arn", "--external-id", "id"}, true},
+		{[]string{"--role-arn", "arn", "--web-identity-token-file", "token"}, true},
+		{[]string{"--web-identity-token-file", "token"}, false},
+		{[]string{"--external-id", "id"}, false},
+		{[]string{"--role-arn", "arn", "--web-identity-token-file", "token", "--external-id", "id"}, false},
+	} {
+		cmd := &cobra.Command{}
+		cmd.Flags().Bool("no-profile", false, "")
+		cmd.Flags().String("role-arn", "", "")
+		cmd.Flags().String("external-id", "", "")
+		cmd.Flags().String("web-identity-token-file", "", "")
+		require.NoError(t, cmd.ParseFlags(tc.args))
+		err := setAwsCredentials(cmd, &partitionConfig{})
+		if tc.valid {
+			assert.NoError(t, err, tc.args)
+		} else {
+			assert.Error(t, err, tc.args)
+		}
+	}
+}
@@ -0,0 +1,441 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/spf13/cobra"
+)
+
+// Visibility timeout of the dead-letter queue messages while inspecting/redriving them
+const dlqVisibilityTimeout = 300
+const exportFileMode = 0o600
+
+type dlqMessage struct {
+	Message types.Message
+	Body    SQSMessageBody
+	// Decoding error of the message body
+	Err error
+}
+
+type dlqSummary struct {
+	Messages int
+	Records  int
+	Invalid  int
+	Buckets  map[string]int
+	Prefixes map[string]int
+	Hours    map[string]int
+}
+
+// dlq subcommand
+var dlqCmd = &cobra.Command{
+	Use:   "dlq",
+	Short: "Inspect and redrive the partitioning dead-letter queue",
+	Long: `Inspect the messages of the partitioning dead-letter queue (messages for which the
+partitioning failed) and redrive them to the partitioning queue.
+
+Examples:
+	cloudfront-logs dlq list --profile swisstopo-bgdi-dev --export failed-keys.txt
+
+	cloudfront-logs dlq redrive --profile swisstopo-bgdi-dev --prefix sys-data.dev.bgdi.ch \
+	--timestamp-from 2025-04-25 --timestamp-to 2025-04-26 --dry-run
+`,
+	Args: cobra.ExactArgs(0),
+	PersistentPreRun: func(cmd *cobra.Command, _ []string) {
+		// The dead-letter queue only depends on the profile
+		unmarkRequiredFlags(cmd, "bucket")
+	},
+	Run: func(cmd *cobra.Command, _ []string) {
+		_ = cmd.Help()
+	},
+}
+
+var dlqListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List and summarise the dead-letter queue messages",
+	Long: `List and summarise (per bucket, prefix and hour) the dead-letter queue messages.
+The messages stay in the dead-letter queue.`,
+	Args: cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, _ []string) (err error) {
+		limit, err := cmd.Flags().GetInt("limit")
+		if err != nil {
+			return err
+		}
+
+		sqsBasics, conf, dlqURL, err := newDlqBasics(cmd)
+		if err != nil {
+			return err
+		}
+
+		messages, err := receiveDlqMessages(sqsBasics, dlqURL, limit)
+		if err != nil {
+			return err
+		}
+		// Always put the messages back in the queue
+		defer func() { err = errors.Join(err, sqsBasics.ReleaseMessages(dlqURL, messages)) }()
+
+		decoded := decodeDlqMessages(messages)
+		if conf.Verbose {
+			for _, message := range decoded {
+				printDlqMessage(message)
+			}
+		}
+		printDlqSummary(dlqURL, summariseDlq(decoded))
+
+		export := cmd.Flag("export").Value.String()
+		if export != "" {
+			keys := dlqKeys(decoded)
+			err = os.WriteFile(export, []byte(strings.Join(keys, "\n")+"\n"), exportFileMode)
+			if err != nil {
+				return fmt.Errorf("failed to export keys to %s: %w", export, err)
+			}
+			fmt.Printf("%d keys exported to %s\n", len(keys), export)
+		}
+
+		return nil
+	},
+}
+
+var dlqRedriveCmd = &cobra.Command{
+	Use:   "redrive",
+	Short: "Send the dead-letter queue messages back to the partitioning queue",
+	Long: `Send the selected dead-letter queue messages back to the partitioning queue.
+
+The keys of the selected messages are published again with --sqs-message-records keys per
+message and the messages are deleted from the dead-letter queue. A message is selected if all
+its keys match the --prefix and --timestamp-from/to filters.`,
+	Args: cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		sqsBasics, conf, dlqURL, err := newDlqBasics(cmd)
+		if err != nil {
+			return err
+		}
+		err = setRedriveConfig(cmd, &conf)
+		if err != nil {
+			return err
+		}
+		err = sqsBasics.SetQueueType(&conf)
+		if err != nil {
+			return err
+		}
+		limit, err := cmd.Flags().GetInt("limit")
+		if err != nil {
+			return err
+		}
+
+		messages, err := receiveDlqMessages(sqsBasics, dlqURL, limit)
+		if err != nil {
+			return err
+		}
+
+		selected, others := selectDlqMessages(decodeDlqMessages(messages), &conf)
+		err = sqsBasics.ReleaseMessages(dlqURL, others)
+		if err != nil {
+			return errors.Join(err, sqsBasics.ReleaseMessages(dlqURL, dlqRawMessages(selected)))
+		}
+		fmt.Printf("%d messages selected, %d messages left in the dead-letter queue\n", len(selected), len(others))
+
+		if conf.DryRun {
+			printDlqSummary(dlqURL, summariseDlq(selected))
+			return sqsBasics.ReleaseMessages(dlqURL, dlqRawMessages(selected))
+		}
+
+		return redriveDlqMessages(sqsBasics, conf, dlqURL, selected)
+	},
+}
+
+//-----------------------------------------------------------------------------
+
+func init() {
+	rootCmd.AddCommand(dlqCmd)
+	dlqCmd.AddCommand(dlqListCmd)
+	dlqCmd.AddCommand(dlqRedriveCmd)
+
+	dlqCmd.PersistentFlags().Int("limit", 0, "Maximum number of messages to process (0 = all)")
+	dlqListCmd.Flags().String("export", "", "Export the keys of the messages to this file (one key per line)")
+
+	dlqRedriveCmd.Flags().StringP("prefix", "p", "", "Only redrive messages with keys having this prefix")
+	dlqRedriveCmd.Flags().StringP("timestamp-from", "s", "", `Only redrive messages with keys having higher OR EQUAL
+	time-stamps. Same formats as partition --timestamp-from (UTC)`)
+	dlqRedriveCmd.Flags().StringP("timestamp-to", "t", "", `Only redrive messages with keys having lower time-stamps.
+	Same formats as partition --timestamp-from (UTC)`)
+	dlqRedriveCmd.Flags().Int64("sqs-message-records", defaultSqsMessageRecords, `Number of s3 records added to one
+	SQS message. (max 100)`)
+	dlqRedriveCmd.Flags().Int64("sqs-batch-size", defaultSqsBatchSize, `Number of SQS messages published in one SQS batch.
+	(max 10)`)
+	addSqsFifoFlags(dlqRedriveCmd)
+	dlqRedriveCmd.Flags().BoolP("dry-run", "d", false, "Show the selected messages without redriving them.")
+}
+
+//-----------------------------------------------------------------------------
+
+// Returns the sqs basics, the base config and the dead-letter queue url
+func newDlqBasics(cmd *cobra.Command) (*SqsBasics, partitionConfig, string, error) {
+	conf, err := newBaseConfig(cmd)
+	if err != nil {
+		return nil, conf, "", err
+	}
+
+	ctx := context.Background()
+	awsConfig, err := newAwsConfig(ctx, conf)
+	if err != nil {
+		return nil, conf, "", err
+	}
+	sqsBasics := NewSqsBasics(ctx, awsConfig)
+
+	dlqURL, err := sqsBasics.GetDeadLetterQueueURL(conf.SqsQueueURL)
+	if err != nil {
+		return nil, conf, "", err
+	}
+	if dlqURL == "" {
+		return nil, conf, "", fmt.Errorf("queue %s has no dead-letter queue", conf.SqsQueueURL)
+	}
+
+	return sqsBasics, conf, dlqURL, nil
+}
+
+// Receives the dead-letter queue messages, the messages received before an error are
+// released so that they don't stay invisible for the visibility timeout
+func receiveDlqMessages(sqsBasics *SqsBasics, dlqURL string, limit int) ([]types.Message, error) {
+	messages, err := sqsBasics.ReceiveAll(dlqURL, dlqVisibilityTimeout, limit)
+	if err != nil {
+		return nil, errors.Join(err, sqsBasics.ReleaseMessages(dlqURL, messages))
+	}
+	return messages, nil
+}
+
+func setRedriveConfig(cmd *cobra.Command, conf *partitionConfig) error {
+	var err error
+	conf.S3Prefix = cmd.Flag("prefix").Value.String()
+	conf.TimeFrom, conf.TimeTo, err = parseTimeWindow(
+		cmd.Flag("timestamp-from").Value.String(),
+		cmd.Flag("timestamp-to").Value.String(),
+		"",
+		time.Now(),
+		time.UTC,
+	)
+	if err != nil {
+		return err
+	}
+
+	messageRecords, err := cmd.Flags().GetInt64("sqs-message-records")
+	if err != nil {
+		return err
+	}
+	if messageRecords > maxSqsMessageRecords {
+		return fmt.Errorf("sqs message records %d too big. Max sqs message records=%d", messageRecords, maxSqsMessageRecords)
+	}
+	conf.SqsMessageRecords = int(messageRecords)
+
+	batchSize, err := cmd.Flags().GetInt64("sqs-batch-size")
+	if err != nil {
+		return err
+	}
+	if batchSize > maxSqsBatchSize {
+		return fmt.Errorf("sqs batch size %d too big. Max sqs batch size=%d", batchSize, maxSqsBatchSize)
+	}
+	conf.SqsBatchSize = int(batchSize)
+
+	err = setSqsFifoConfig(cmd, conf)
+	if err != nil {
+		return err
+	}
+
+	conf.DryRun, err = cmd.Flags().GetBool("dry-run")
+	return err
+}
+
+func decodeDlqMessages(messages []types.Message) []dlqMessage {
+	decoded := make([]dlqMessage, 0, len(messages))
+	for _, message := range messages {
+		m := dlqMessage{Message: message}
+		if message.Body == nil {
+			m.Err = errors.New("empty message body")
+		} else {
+			m.Err = json.Unmarshal([]byte(*message.Body), &m.Body)
+		}
+		decoded = append(decoded, m)
+	}
+	return decoded
+}
+
+func summariseDlq(messages []dlqMessage) dlqSummary {
+	summary := dlqSummary{
+		Buckets:  map[string]int{},
+		Prefixes: map[string]int{},
+		Hours:    map[string]int{},
+	}
+	for _, message := range messages {
+		summary.Messages++
+		if message.Err != nil {
+			summary.Invalid++
+			continue
+		}
+		for _, record := range message.Body.Records {
+			summary.Records++
+			summary.Buckets[record.S3.Bucket.Name]++
+			matches := keyRe.FindStringSubmatch(decodeS3Key(record.S3.Object.Key))
+			if matches == nil {
+				summary.Prefixes["<invalid key>"]++
+				continue
+			}
+			summary.Prefixes[matches[1]]++
+			summary.Hours[matches[2]]++
+		}
+	}
+	return summary
+}
+
+// Splits the valid messages having all their keys matching the prefix and time window
+// filters of the config from the others
+func selectDlqMessages(messages []dlqMessage, conf *partitionConfig) ([]dlqMessage, []types.Message) {
+	selected := []dlqMessage{}
+	others := []types.Message{}
+	for _, message := range messages {
+		if message.Err == nil && len(message.Body.Records) > 0 && matchDlqMessage(message, conf) {
+			selected = append(selected, message)
+		} else {
+			others = append(others, message.Message)
+		}
+	}
+	return selected, others
+}
+
+func matchDlqMessage(message dlqMessage, conf *partitionConfig) bool {
+	for _, record := range message.Body.Records {
+		key := decodeS3Key(record.S3.Object.Key)
+		if !strings.HasPrefix(key, conf.S3Prefix) {
+			return false
+		}
+		matches := keyRe.FindStringSubmatch(key)
+		if matches == nil {
+			return false
+		}
+		timestamp, err := parseTimestamp(matches[2])
+		if err != nil {
+			return false
+		}
+		if (!conf.TimeFrom.IsZero() && timestamp.Before(conf.TimeFrom)) ||
+			(!conf.TimeTo.IsZero() && !timestamp.Before(conf.TimeTo)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Publishes the keys of the messages to the partitioning queue, per bucket, and deletes
+// the messages from the dead-letter queue
+func redriveDlqMessages(sqsBasics *SqsBasics, conf partitionConfig, dlqURL string, messages []dlqMessage) error {
+	objectsPerBucket := map[string][]s3types.Object{}
+	for _, message := range messages {
+		for _, record := range message.Body.Records {
+			bucket := record.S3.Bucket.Name
+			objectsPerBucket[bucket] = append(objectsPerBucket[bucket], recordObject(record))
+		}
+	}
+
+	m := metrics{}
+	for _, bucket := range slices.Sorted(maps.Keys(objectsPerBucket)) {
+		bucketConf := conf
+		bucketConf.S3Bucket = bucket
+		err := sqsBasics.PublishKeys(bucketConf, objectsPerBucket[bucket], &m, nil)
+		if err != nil {
+			// Put the messages back, some keys might be partitioned twice
+			return errors.Join(err, sqsBasics.ReleaseMessages(dlqURL, dlqRawMessages(messages)))
+		}
+		fmt.Printf("%d keys of bucket %s sent to %s\n", len(objectsPerBucket[bucket]), bucket, conf.SqsQueueURL)
+	}
+
+	err := sqsBasics.DeleteMessages(dlqURL, dlqRawMessages(messages))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d messages deleted from %s\n", len(messages), dlqURL)
+	return nil
+}
+
+// Returns the s3 object of the record
+func recordObject(record S3Event) s3types.Object {
+	obj := s3types.Object{
+		Key:  aws.String(decodeS3Key(record.S3.Object.Key)),
+		Size: aws.Int64(record.S3.Object.Size),
+	}
+	if record.S3.Object.ETag != "" {
+		obj.ETag = aws.String(`"` + record.S3.Object.ETag + `"`)
+	}
+	if eventTime, err := time.Parse(time.RFC3339, record.EventTime); err == nil {
+		obj.LastModified = &eventTime
+	}
+	return obj
+}
+
+func dlqRawMessages(messages []dlqMessage) []types.Message {
+	raw := make([]types.Message, 0, len(messages))
+	for _, message := range messages {
+		raw = append(raw, message.Message)
+	}
+	return raw
+}
+
+func dlqKeys(messages []dlqMessage) []string {
+	keys := []string{}
+	for _, message := range messages {
+		for _, record := range message.Body.Records {
+			keys = append(keys, decodeS3Key(record.S3.Object.Key))
+		}
+	}
+	slices.Sort(keys)
+	return slices.Compact(keys)
+}
+
+//-----------------------------------------------------------------------------
+
+func printDlqMessage(message dlqMessage) {
+	fmt.Printf("Message %s\n", *message.Message.MessageId)
+	if message.Err != nil {
+		fmt.Printf("\tinvalid body: %s\n", message.Err)
+		return
+	}
+	for _, record := range message.Body.Records {
+		fmt.Printf("\ts3://%s/%s\n", record.S3.Bucket.Name, decodeS3Key(record.S3.Object.Key))
+	}
+}
+
+func printDlqSummary(dlqURL string, summary dlqSummary) {
+	lineSeparator := strings.Repeat("-", numberOfSeparatorChars)
+	fmt.Println(lineSeparator)
+	fmt.Printf(`Dead-letter queue: %s
+    Messages           : %8d
+    Invalid messages   : %8d
+    Records            : %8d
+`,
+		dlqURL,
+		summary.Messages,
+		summary.Invalid,
+		summary.Records,
+	)
+	for _, group := range []struct {
+		title  string
+		counts map[string]int
+	}{
+		{"Buckets", summary.Buckets},
+		{"Prefixes", summary.Prefixes},
+		{"Hours", summary.Hours},
+	} {
+		fmt.Printf("    %s\n", group.title)
+		for _, name := range slices.Sorted(maps.Keys(group.counts)) {
+			fmt.Printf("        %-40s: %8d\n", name, group.counts[name])
+		}
+	}
+	fmt.Println(lineSeparator)
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDlqMessages(t *testing.T) {
+	messages := decodeDlqMessages([]types.Message{
+		{
+			MessageId: aws.String("1"),
+			Body: aws.String(`{"Records":[
+				{"S3":{"Bucket":{"Name":"bucket"},"Object":{"Key":"a.ch/E1.2025-04-24-14.x.gz"}}},
+				{"S3":{"Bucket":{"Name":"bucket"},"Object":{"Key":"a.ch/E1.2025-04-24-15.y.gz"}}}
+			]}`),
+		},
+		{
+			MessageId: aws.String("2"),
+			Body:      aws.String(`{"Records":[{"S3":{"Bucket":{"Name":"bucket"},"Object":{"Key":"b.ch/E2.2025-04-25-01.z.gz"}}}]}`),
+		},
+		{
+			MessageId: aws.String("3"),
+			Body:      aws.String(`not json`),
+		},
+	})
+
+	summary := summariseDlq(messages)
+	assert.Equal(t, 3, summary.Messages)
+	assert.Equal(t, 1, summary.Invalid)
+	assert.Equal(t, 3, summary.Records)
+	assert.Equal(t, map[string]int{"bucket": 3}, summary.Buckets)
+	assert.Equal(t, map[string]int{"a.ch": 2, "b.ch": 1}, summary.Prefixes)
+	assert.Equal(t, map[string]int{"2025-04-24-14": 1, "2025-04-24-15": 1, "2025-04-25-01": 1}, summary.Hours)
+
+	conf := partitionConfig{TimeFrom: time.Date(2025, 4, 24, 15, 0, 0, 0, time.UTC)}
+	selected, others := selectDlqMessages(messages, &conf)
+	assert.Len(t, selected, 1)
+	assert.Equal(t, "2", *selected[0].Message.MessageId)
+	assert.Len(t, others, 2)
+
+	conf = partitionConfig{S3Prefix: "a.ch/"}
+	selected, others = selectDlqMessages(messages, &conf)
+	assert.Len(t, selected, 1)
+	assert.Equal(t, "1", *selected[0].Message.MessageId)
+	assert.Len(t, others, 2)
+	assert.Equal(t, []string{"a.ch/E1.2025-04-24-14.x.gz", "a.ch/E1.2025-04-24-15.y.gz"}, dlqKeys(selected))
+}
@@ -0,0 +1,384 @@
+package cmd
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/md5" //nolint:gosec // md5 is used to compare with the s3 ETag
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/spf13/cobra"
+)
+
+const defaultDownloadParallel = 8
+const downloadFileMode = 0o600
+const downloadDirMode = 0o750
+
+// Maximum size of a log line when decompressing
+const maxLogLineSize = 1024 * 1024
+
+type downloadResult struct {
+	Key     string
+	Bytes   int64
+	Skipped bool
+	Err     error
+}
+
+type downloadStats struct {
+	Total      int
+	Downloaded int
+	Skipped    int
+	Failed     int
+	Bytes      int64
+}
+
+// download subcommand
+var downloadCmd = &cobra.Command{
+	Use:   "download",
+	Short: "Download the cloudfront log files of a time window",
+	Long: `Download the cloudfront log files selected by the same prefix and time filters as the
+partition command to a local directory, keeping the s3 key as path.
+
+Files already downloaded with the same ETag are skipped. With --decompress the files are
+also decompressed and concatenated into one TSV file per prefix and hour
+(<output-dir>/<prefix>/<yyyy-mm-dd-hh>.tsv), the comment lines (#Version, #Fields)
+are only kept from the first file.
+
+Examples:
+	cloudfront-logs download --profile swisstopo-bgdi-dev --bucket swisstopo-bgdi-dev-cloudfront-logs-v2 \
+	--prefix sys-data.dev.bgdi.ch --timestamp-from 2025-04-25-13 --duration 2h --output-dir logs --decompress
+`,
+	Args: cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		timeStart := time.Now()
+		conf, err := newS3Config(cmd)
+		if err != nil {
+			return err
+		}
+		err = setKeyFilters(cmd, &conf)
+		if err != nil {
+			return err
+		}
+		excluded, err := cmd.Flags().GetStringSlice("exclude-storage-class")
+		if err != nil {
+			return err
+		}
+		for _, class := range excluded {
+			conf.ExcludedClasses = append(conf.ExcludedClasses, strings.ToUpper(class))
+		}
+		outputDir := cmd.Flag("output-dir").Value.String()
+		parallel, err := cmd.Flags().GetInt("parallel")
+		if err != nil {
+			return err
+		}
+		decompress, err := cmd.Flags().GetBool("decompress")
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		awsConfig, err := newAwsConfig(ctx, conf)
+		if err != nil {
+			return err
+		}
+		s3Basics := NewS3Basics(ctx, awsConfig)
+
+		objects, err := listObjectsToDownload(ctx, s3Basics, conf)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s - Downloading %d files of s3://%s/%s %s to %s\n",
+			timeStart.Format("2006-01-02 15:04:05"),
+			len(objects),
+			conf.S3Bucket,
+			conf.S3Prefix,
+			formatTimeWindow(conf.TimeFrom, conf.TimeTo),
+			outputDir,
+		)
+
+		stats, err := runDownload(s3Basics, conf.S3Bucket, objects, outputDir, parallel)
+		fmt.Printf("%s - %d files downloaded (%d bytes), %d files skipped, %d files failed in %s\n",
+			time.Now().Format("2006-01-02 15:04:05"),
+			stats.Downloaded,
+			stats.Bytes,
+			stats.Skipped,
+			stats.Failed,
+			time.Since(timeStart).Round(time.Millisecond),
+		)
+		if err != nil {
+			return err
+		}
+
+		if decompress {
+			files, e := concatHourlyLogs(objects, outputDir)
+			if e != nil {
+				return e
+			}
+			for _, file := range files {
+				fmt.Printf("\t%s\n", file)
+			}
+		}
+		return nil
+	},
+}
+
+//-----------------------------------------------------------------------------
+
+func init() {
+	rootCmd.AddCommand(downloadCmd)
+
+	addKeyFilterFlags(downloadCmd)
+	downloadCmd.Flags().StringSlice("exclude-storage-class", []string{"GLACIER", "DEEP_ARCHIVE"}, `Files with
+	one of these storage classes are skipped (archived objects cannot be downloaded).`)
+	downloadCmd.Flags().StringP("output-dir", "o", ".", "Local directory where the files are downloaded")
+	downloadCmd.Flags().IntP("parallel", "j", defaultDownloadParallel, "Number of files downloaded in parallel")
+	downloadCmd.Flags().Bool("decompress", false, "Decompress and concatenate the files into one TSV file per hour")
+}
+
+//-----------------------------------------------------------------------------
+
+// Returns the objects selected by the prefix, time and storage class filters of the config
+func listObjectsToDownload(ctx context.Context, s3Basics *S3Basics, conf partitionConfig) ([]types.Object, error) {
+	objects := []types.Object{}
+	paginator := s3Basics.GetListObjectsPaginator(conf)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		keys, err := getKeysToPartition(page.Contents, &conf, &metrics{})
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, selectObjects(page.Contents, keys)...)
+	}
+	return objects, nil
+}
+
+// Downloads the objects with a pool of workers, the files already downloaded with the
+// same ETag are skipped.
+func runDownload(
+	s3Basics *S3Basics,
+	bucket string,
+	objects []types.Object,
+	outputDir string,
+	workers int,
+) (downloadStats, error) {
+	stats := downloadStats{Total: len(objects)}
+	taskChan := make(chan types.Object, len(objects))
+	resultChan := make(chan downloadResult)
+
+	var wg sync.WaitGroup
+	for range max(workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for obj := range taskChan {
+				resultChan <- downloadObject(s3Basics, bucket, obj, outputDir)
+			}
+		}()
+	}
+
+	for _, obj := range objects {
+		taskChan <- obj
+	}
+	close(taskChan)
+
+	go func() {
+		wg.Wait()
+		close(resultChan)
+	}()
+
+	failed := []string{}
+	for result := range resultChan {
+		switch {
+		case result.Err != nil:
+			stats.Failed++
+			failed = append(failed, fmt.Sprintf("%s: %s", result.Key, result.Err))
+		case result.Skipped:
+			stats.Skipped++
+		default:
+			stats.Downloaded++
+			stats.Bytes += result.Bytes
+		}
+		printDownloadProgress(stats)
+	}
+	fmt.Println("")
+
+	if len(failed) > 0 {
+		for _, failure := range failed {
+			fmt.Printf("\t%s\n", failure)
+		}
+		return stats, fmt.Errorf("%d files failed to download", len(failed))
+	}
+	return stats, nil
+}
+
+func downloadObject(s3Basics *S3Basics, bucket string, obj types.Object, outputDir string) downloadResult {
+	key := aws.ToString(obj.Key)
+	result := downloadResult{Key: key}
+
+	filename, err := localPath(outputDir, key)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	if isDownloaded(filename, aws.ToString(obj.ETag)) {
+		result.Skipped = true
+		return result
+	}
+
+	err = os.MkdirAll(filepath.Dir(filename), downloadDirMode)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Bytes, result.Err = s3Basics.DownloadObject(bucket, key, filename)
+	return result
+}
+
+// Returns the local path of the key within the output directory
+func localPath(outputDir, key string) (string, error) {
+	filename := filepath.Join(outputDir, filepath.FromSlash(key))
+	rel, err := filepath.Rel(outputDir, filename)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid key %s outside of the output directory", key)
+	}
+	return filename, nil
+}
+
+// Returns true if the file exists with the content of the ETag. The ETag of multipart
+// uploads is not a md5 hash of the content, these files are always downloaded.
+func isDownloaded(filename, etag string) bool {
+	etag = strings.Trim(etag, `"`)
+	if etag == "" || strings.Contains(etag, "-") {
+		return false
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	hash := md5.New() //nolint:gosec // md5 is used to compare with the s3 ETag
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return false
+	}
+	return hex.EncodeToString(hash.Sum(nil)) == etag
+}
+
+// Decompresses and concatenates the downloaded files into one TSV file per prefix and hour.
+// Returns the TSV files written.
+func concatHourlyLogs(objects []types.Object, outputDir string) ([]string, error) {
+	hours := map[string][]string{}
+	for _, obj := range objects {
+		key := aws.ToString(obj.Key)
+		matches := keyRe.FindStringSubmatch(key)
+		if matches == nil {
+			return nil, fmt.Errorf("invalid key name: %s", key)
+		}
+		tsv := filepath.Join(outputDir, filepath.FromSlash(matches[1]), matches[2]+".tsv")
+		hours[tsv] = append(hours[tsv], key)
+	}
+
+	files := []string{}
+	for tsv, keys := range hours {
+		slices.Sort(keys)
+		err := concatLogs(tsv, keys, outputDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", tsv, err)
+		}
+		files = append(files, tsv)
+	}
+	slices.Sort(files)
+	return files, nil
+}
+
+func concatLogs(tsv string, keys []string, outputDir string) error {
+	file, err := os.OpenFile(tsv, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, downloadFileMode)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+
+	for i, key := range keys {
+		filename, e := localPath(outputDir, key)
+		if e == nil {
+			// Only keep the comment lines of the first file
+			e = decompressLog(writer, filename, i == 0)
+		}
+		if e != nil {
+			_ = file.Close()
+			return e
+		}
+	}
+
+	err = writer.Flush()
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Writes the decompressed lines of the gzip file, without the comment lines if not
+// keepComments.
+func decompressLog(writer io.Writer, filename string, keepComments bool) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	defer reader.Close()
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxLogLineSize)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if !keepComments && len(line) > 0 && line[0] == '#' {
+			continue
+		}
+		_, err = writer.Write(append(line, '\n'))
+		if err != nil {
+			return err
+		}
+	}
+	err = scanner.Err()
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%s: truncated file: %w", filename, err)
+	}
+	return err
+}
+
+func printDownloadProgress(stats downloadStats) {
+	fmt.Print("\033[G\033[K") // move the cursor left and clear the line
+	fmt.Printf("%s - %8d/%d files, %8d downloaded, %8d skipped, %8d failed, %12d bytes",
+		time.Now().Format("2006-01-02 15:04:05"),
+		stats.Downloaded+stats.Skipped+stats.Failed,
+		stats.Total,
+		stats.Downloaded,
+		stats.Skipped,
+		stats.Failed,
+		stats.Bytes,
+	)
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeGzip(t *testing.T, filename, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(filename), downloadDirMode))
+	file, err := os.Create(filename)
+	require.NoError(t, err)
+	writer := gzip.NewWriter(file)
+	_, err = writer.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	require.NoError(t, file.Close())
+}
+
+func TestLocalPath(t *testing.T) {
+	filename, err := localPath("out", "a.ch/E1.2025-04-24-14.x.gz")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join("out", "a.ch", "E1.2025-04-24-14.x.gz"), filename)
+
+	_, err = localPath("out", "../E1.2025-04-24-14.x.gz")
+	assert.Error(t, err)
+}
+
+func TestIsDownloaded(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(filename, []byte("hello"), downloadFileMode))
+
+	assert.True(t, isDownloaded(filename, `"5d41402abc4b2a76b9719d911017c592"`))
+	assert.False(t, isDownloaded(filename, `"00000000000000000000000000000000"`))
+	assert.False(t, isDownloaded(filename, `"5d41402abc4b2a76b9719d911017c592-2"`))
+	assert.False(t, isDownloaded(filename+".missing", `"5d41402abc4b2a76b9719d911017c592"`))
+}
+
+func TestConcatHourlyLogs(t *testing.T) {
+	dir := t.TempDir()
+	header := "#Version: 1.0\n#Fields: date time\n"
+	writeGzip(t, filepath.Join(dir, "a.ch", "E1.2025-04-24-14.b.gz"), header+"2025-04-24\t14:10:00\n")
+	writeGzip(t, filepath.Join(dir, "a.ch", "E1.2025-04-24-14.a.gz"), header+"2025-04-24\t14:00:00\n")
+	writeGzip(t, filepath.Join(dir, "a.ch", "E1.2025-04-24-15.c.gz"), header+"2025-04-24\t15:00:00\n")
+	objects := []types.Object{
+		{Key: aws.String("a.ch/E1.2025-04-24-14.b.gz")},
+		{Key: aws.String("a.ch/E1.2025-04-24-14.a.gz")},
+		{Key: aws.String("a.ch/E1.2025-04-24-15.c.gz")},
+	}
+
+	files, err := concatHourlyLogs(objects, dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "a.ch", "2025-04-24-14.tsv"),
+		filepath.Join(dir, "a.ch", "2025-04-24-15.tsv"),
+	}, files)
+
+	content, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	assert.Equal(t, header+"2025-04-24\t14:00:00\n2025-04-24\t14:10:00\n", string(content))
+}
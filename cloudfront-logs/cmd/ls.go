@@ -0,0 +1,230 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/spf13/cobra"
+)
+
+// ls output formats
+const (
+	lsFormatTable = "table"
+	lsFormatJSON  = "json"
+	lsFormatCSV   = "csv"
+	lsFormatKeys  = "keys"
+)
+
+// lsEntry is one log file of the ls output
+type lsEntry struct {
+	Key          string    `json:"key"`
+	Timestamp    time.Time `json:"timestamp"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+// lsPrinter prints the entries in the ls output format, page per page
+type lsPrinter struct {
+	writer    io.Writer
+	csvWriter *csv.Writer
+	format    string
+}
+
+// ls subcommand
+var lsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List the cloudfront log files with their timestamps and sizes",
+	Long: `List the cloudfront log files of the bucket selected by the same prefix and time filters
+as the partition command, with their key, timestamp (from the key), size and last modified time.
+
+Formats:
+	table: aligned columns (default)
+	json : one json object per line (JSON lines)
+	csv  : csv with header
+	keys : one key per line
+
+Examples:
+	cloudfront-logs ls --profile swisstopo-bgdi-dev --bucket swisstopo-bgdi-dev-cloudfront-logs-v2 \
+	--prefix sys-data.dev.bgdi.ch --timestamp-from 2025-04-25-13 --duration 1h
+
+	cloudfront-logs ls --profile swisstopo-bgdi-dev --bucket swisstopo-bgdi-dev-cloudfront-logs-v2 \
+	--prefix sys-data.dev.bgdi.ch --timestamp-from yesterday --format keys > keys.txt
+`,
+	Args: cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		conf, err := newS3Config(cmd)
+		if err != nil {
+			return err
+		}
+		err = setKeyFilters(cmd, &conf)
+		if err != nil {
+			return err
+		}
+
+		printer, err := newLsPrinter(cmd.OutOrStdout(), cmd.Flag("format").Value.String())
+		if err != nil {
+			return err
+		}
+
+		ctx := context.Background()
+		awsConfig, err := newAwsConfig(ctx, conf)
+		if err != nil {
+			return err
+		}
+		s3Basics := NewS3Basics(ctx, awsConfig)
+
+		return runLs(ctx, s3Basics, conf, printer)
+	},
+}
+
+//-----------------------------------------------------------------------------
+
+func init() {
+	rootCmd.AddCommand(lsCmd)
+
+	addKeyFilterFlags(lsCmd)
+	lsCmd.Flags().StringP("format", "f", lsFormatTable, "Output format. One of ['table', 'json', 'csv', 'keys']")
+}
+
+// Adds the prefix and time window flags used by setKeyFilters to the command
+func addKeyFilterFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP("prefix", "p", "", "Prefix of s3 files we want to process.")
+	cmd.Flags().StringP("timestamp-from", "s", "", `Files with lower time-stamps are skipped.
+	Same formats as partition --timestamp-from`)
+	cmd.Flags().StringP("timestamp-to", "t", "", `Files with higher OR EQUAL time-stamps are skipped.
+	Same formats as partition --timestamp-from`)
+	cmd.Flags().String("duration", "", `Duration of the time window starting at --timestamp-from,
+	alternative to --timestamp-to. Examples: 6h, 2d, 1w`)
+	cmd.Flags().String("timezone", "UTC", `Time zone of the --timestamp-from/to values without explicit offset.
+	Examples: UTC, Europe/Zurich`)
+}
+
+//-----------------------------------------------------------------------------
+
+func setKeyFilters(cmd *cobra.Command, conf *partitionConfig) error {
+	conf.S3Prefix = cmd.Flag("prefix").Value.String()
+	return setTimeWindow(cmd, conf)
+}
+
+func runLs(ctx context.Context, s3Basics *S3Basics, conf partitionConfig, printer *lsPrinter) error {
+	err := printer.header()
+	if err != nil {
+		return err
+	}
+
+	paginator := s3Basics.GetListObjectsPaginator(conf)
+	for paginator.HasMorePages() {
+		page, e := paginator.NextPage(ctx)
+		if e != nil {
+			return e
+		}
+
+		entries, e := getLsEntries(page.Contents, &conf)
+		if e != nil {
+			return e
+		}
+
+		e = printer.print(entries)
+		if e != nil {
+			return e
+		}
+	}
+	return printer.flush()
+}
+
+// Returns the entries of the log files selected by the prefix and time filters of the config
+func getLsEntries(contents []types.Object, conf *partitionConfig) ([]lsEntry, error) {
+	keys, err := getKeysToPartition(contents, conf, &metrics{})
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]lsEntry, 0, len(keys))
+	for _, obj := range selectObjects(contents, keys) {
+		// The key has been matched by getKeysToPartition
+		matches := keyRe.FindStringSubmatch(*obj.Key)
+		timestamp, e := parseTimestamp(matches[2])
+		if e != nil {
+			return nil, e
+		}
+		entries = append(entries, lsEntry{
+			Key:          *obj.Key,
+			Timestamp:    timestamp,
+			Size:         aws.ToInt64(obj.Size),
+			LastModified: aws.ToTime(obj.LastModified).UTC(),
+		})
+	}
+	return entries, nil
+}
+
+func newLsPrinter(writer io.Writer, format string) (*lsPrinter, error) {
+	printer := &lsPrinter{writer: writer, format: format}
+	switch format {
+	case lsFormatTable, lsFormatJSON, lsFormatKeys:
+	case lsFormatCSV:
+		printer.csvWriter = csv.NewWriter(writer)
+	default:
+		return nil, fmt.Errorf("invalid --format %s. See --help for allowed values", format)
+	}
+	return printer, nil
+}
+
+func (p *lsPrinter) header() error {
+	var err error
+	switch p.format {
+	case lsFormatTable:
+		_, err = fmt.Fprintf(p.writer, "%-80s %-16s %12s %-20s\n", "KEY", "TIMESTAMP", "SIZE", "LAST-MODIFIED")
+	case lsFormatCSV:
+		err = p.csvWriter.Write([]string{"key", "timestamp", "size", "last_modified"})
+	}
+	return err
+}
+
+func (p *lsPrinter) print(entries []lsEntry) error {
+	for _, entry := range entries {
+		var err error
+		switch p.format {
+		case lsFormatTable:
+			_, err = fmt.Fprintf(p.writer, "%-80s %-16s %12d %-20s\n",
+				entry.Key,
+				entry.Timestamp.Format("2006-01-02 15:04"),
+				entry.Size,
+				entry.LastModified.Format("2006-01-02 15:04:05"),
+			)
+		case lsFormatJSON:
+			var line []byte
+			line, err = json.Marshal(entry)
+			if err == nil {
+				_, err = fmt.Fprintln(p.writer, string(line))
+			}
+		case lsFormatCSV:
+			err = p.csvWriter.Write([]string{
+				entry.Key,
+				entry.Timestamp.Format(time.RFC3339),
+				strconv.FormatInt(entry.Size, 10),
+				entry.LastModified.Format(time.RFC3339),
+			})
+		case lsFormatKeys:
+			_, err = fmt.Fprintln(p.writer, entry.Key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return p.flush()
+}
+
+func (p *lsPrinter) flush() error {
+	if p.csvWriter == nil {
+		return nil
+	}
+	p.csvWriter.Flush()
+	return p.csvWriter.Error()
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetLsEntries(t *testing.T) {
+	modified := time.Date(2025, 4, 24, 15, 3, 0, 0, time.UTC)
+	contents := []types.Object{
+		{Key: aws.String("prefix/")},
+		{Key: aws.String("prefix/E1.2025-04-24-13.a.gz"), Size: aws.Int64(10), LastModified: &modified},
+		{Key: aws.String("prefix/E1.2025-04-24-14.b.gz"), Size: aws.Int64(20), LastModified: &modified},
+	}
+	conf := partitionConfig{TimeFrom: time.Date(2025, 4, 24, 14, 0, 0, 0, time.UTC)}
+
+	entries, err := getLsEntries(contents, &conf)
+	require.NoError(t, err)
+	assert.Equal(t, []lsEntry{
+		{
+			Key:          "prefix/E1.2025-04-24-14.b.gz",
+			Timestamp:    time.Date(2025, 4, 24, 14, 0, 0, 0, time.UTC),
+			Size:         20,
+			LastModified: modified,
+		},
+	}, entries)
+}
+
+func TestLsPrinter(t *testing.T) {
+	entries := []lsEntry{
+		{
+			Key:          "prefix/E1.2025-04-24-14.b.gz",
+			Timestamp:    time.Date(2025, 4, 24, 14, 0, 0, 0, time.UTC),
+			Size:         20,
+			LastModified: time.Date(2025, 4, 24, 15, 3, 0, 0, time.UTC),
+		},
+	}
+	expected := map[string]string{
+		lsFormatJSON: `{"key":"prefix/E1.2025-04-24-14.b.gz","timestamp":"2025-04-24T14:00:00Z",` +
+			`"size":20,"lastModified":"2025-04-24T15:03:00Z"}` + "\n",
+		lsFormatCSV: "key,timestamp,size,last_modified\n" +
+			"prefix/E1.2025-04-24-14.b.gz,2025-04-24T14:00:00Z,20,2025-04-24T15:03:00Z\n",
+		lsFormatKeys: "prefix/E1.2025-04-24-14.b.gz\n",
+	}
+
+	for format, output := range expected {
+		var buf bytes.Buffer
+		printer, err := newLsPrinter(&buf, format)
+		require.NoError(t, err)
+		require.NoError(t, printer.header())
+		require.NoError(t, printer.print(entries))
+		assert.Equal(t, output, buf.String(), format)
+	}
+
+	_, err := newLsPrinter(&bytes.Buffer{}, "xml")
+	assert.Error(t, err)
+}
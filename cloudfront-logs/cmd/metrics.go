@@ -11,6 +11,20 @@ type metrics struct {
 			Fetched     int
 			Partitioned int
 			Skipped     int
+			// Already partitioned according to the state store
+			AlreadyPartitioned int
+			// Excluded by the object metadata filters
+			Filtered struct {
+				Size         int
+				LastModified int
+				StorageClass int
+			}
+			// Excluded by the sampling options (--shard, --sample and --limit)
+			SampledOut struct {
+				Shard  int
+				Sample int
+				Limit  int
+			}
 		}
 		Pages int
 	}
@@ -27,7 +41,7 @@ type metrics struct {
 	Prefixes []string
 }
 
-func collectMetrics(ch chan metrics, timeStart time.Time) metrics {
+func collectMetrics(ch chan metrics, timeStart time.Time, showProgress bool) metrics {
 	m := metrics{}
 	m.Timestamps.Start = timeStart
 
@@ -38,18 +52,46 @@ func collectMetrics(ch chan metrics, timeStart time.Time) metrics {
 			break
 		}
 
-		m.Counters.Files.Fetched += metric.Counters.Files.Fetched
-		m.Counters.Files.Partitioned += metric.Counters.Files.Partitioned
-		m.Counters.Files.Skipped += metric.Counters.Files.Skipped
-		m.Counters.Pages += metric.Counters.Pages
+		m.add(metric)
 
-		for _, prefix := range metric.Prefixes {
-			if !slices.Contains(m.Prefixes, prefix) {
-				m.Prefixes = append(m.Prefixes, prefix)
-			}
+		if showProgress {
+			printProgress(&m)
 		}
-		printProgress(&m)
 	}
 
 	return m
 }
+
+// Returns the number of files excluded by the object metadata filters
+func (m *metrics) filteredFiles() int {
+	return m.Counters.Files.Filtered.Size +
+		m.Counters.Files.Filtered.LastModified +
+		m.Counters.Files.Filtered.StorageClass
+}
+
+// Returns the number of files excluded by the sampling options
+func (m *metrics) sampledOutFiles() int {
+	return m.Counters.Files.SampledOut.Shard +
+		m.Counters.Files.SampledOut.Sample +
+		m.Counters.Files.SampledOut.Limit
+}
+
+// Adds the counters and prefixes of the metric
+func (m *metrics) add(metric metrics) {
+	m.Counters.Files.Fetched += metric.Counters.Files.Fetched
+	m.Counters.Files.Partitioned += metric.Counters.Files.Partitioned
+	m.Counters.Files.Skipped += metric.Counters.Files.Skipped
+	m.Counters.Files.AlreadyPartitioned += metric.Counters.Files.AlreadyPartitioned
+	m.Counters.Files.Filtered.Size += metric.Counters.Files.Filtered.Size
+	m.Counters.Files.Filtered.LastModified += metric.Counters.Files.Filtered.LastModified
+	m.Counters.Files.Filtered.StorageClass += metric.Counters.Files.Filtered.StorageClass
+	m.Counters.Files.SampledOut.Shard += metric.Counters.Files.SampledOut.Shard
+	m.Counters.Files.SampledOut.Sample += metric.Counters.Files.SampledOut.Sample
+	m.Counters.Files.SampledOut.Limit += metric.Counters.Files.SampledOut.Limit
+	m.Counters.Pages += metric.Counters.Pages
+	for _, prefix := range metric.Prefixes {
+		if !slices.Contains(m.Prefixes, prefix) {
+			m.Prefixes = append(m.Prefixes, prefix)
+		}
+	}
+}
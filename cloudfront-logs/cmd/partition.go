@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"hash/fnv"
 	"regexp"
 	"slices"
 	"strings"
@@ -11,7 +12,7 @@ import (
 	"github.com/spf13/cobra"
 	"golang.org/x/net/context"
 
-	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
@@ -20,6 +21,24 @@ const defaultSqsMessageRecords = 10
 const maxSqsBatchSize = 10
 const maxSqsMessageRecords = 100
 
+// SQS limits of the message and batch payloads
+const maxSqsMessageBytes = 256 * 1024
+const maxSqsBatchBytes = 256 * 1024
+
+// FIFO queue message group strategies
+const (
+	sqsGroupByPrefix     = "prefix"
+	sqsGroupByHour       = "hour"
+	sqsGroupByPrefixHour = "prefix-hour"
+	sqsGroupByBucket     = "bucket"
+)
+
+// FIFO queue message deduplication strategies
+const (
+	sqsDeduplicationKeyHash = "key-hash"
+	sqsDeduplicationContent = "content"
+)
+
 // partition subcommand
 var partitionCmd = &cobra.Command{
 	Use:   "partition",
@@ -45,18 +64,34 @@ Examples:
 
 		printStart(partitionConf, timeStart)
 
+		if !partitionConf.SkipPreflight {
+			err = runPreflight(context.Background(), partitionConf)
+			if err != nil {
+				return err
+			}
+		}
+
+		var state *StateStore
+		if partitionConf.StateFile != "" {
+			state, err = NewStateStore(partitionConf.StateFile)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = state.Close() }()
+		}
+
 		// Collect metrics
 		ch := make(chan metrics)
 		var m metrics
 		var wg sync.WaitGroup
 		wg.Add(1)
 		go func() {
-			m = collectMetrics(ch, timeStart)
+			m = collectMetrics(ch, timeStart, true)
 			wg.Done()
 		}()
 
 		// Do the partitioning work
-		err = runPartition(partitionConf, ch)
+		err = runPartition(context.Background(), partitionConf, state, ch)
 		if err != nil {
 			return err
 		}
@@ -84,43 +119,84 @@ func init() {
 	// will be global for your application.
 	rootCmd.AddCommand(partitionCmd)
 
-	partitionCmd.Flags().StringP("prefix", "p", "", "Prefix of s3 files we want to process.")
-	partitionCmd.Flags().StringP("timestamp-from", "s", "", `Source-files with lower time-stamps are skipped.
-	Format: yyyy[-mm[-dd]-[hh]]. Examples: 2025-04-23-01, 2025-03-10, 2025-02, 2024`)
-	partitionCmd.Flags().StringP("timestamp-to", "t", "", `Source-files with higher OR EQUAL time-stamps are skipped.
-	Format: yyyy[-mm[-dd]-[hh]]. Examples: 2025-05-01-13, 2025-04-01, 2025-02, 2025`)
-	partitionCmd.Flags().Int64("sqs-message-records", defaultSqsMessageRecords, `Number of s3 records added to one
+	addPartitionFlags(partitionCmd)
+}
+
+// Adds the flags used by newPartionConfig to the command
+func addPartitionFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP("prefix", "p", "", "Prefix of s3 files we want to process.")
+	cmd.Flags().StringP("timestamp-from", "s", "", `Source-files with lower time-stamps are skipped.
+	Format: yyyy[-mm[-dd]-[hh]], RFC3339, ISO week, relative time or keyword.
+	Examples: 2025-04-23-01, 2025-03-10, 2025-02, 2024, 2025-04-23T01:00:00+02:00, 2025-W17, -6h, -2d,
+	now, today, yesterday, this-week, last-week. Truncated to the UTC hour of the cloudfront keys`)
+	cmd.Flags().StringP("timestamp-to", "t", "", `Source-files with higher OR EQUAL time-stamps are skipped.
+	Same formats as --timestamp-from. Examples: 2025-05-01-13, 2025-04-01, 2025-02, 2025, today`)
+	cmd.Flags().String("duration", "", `Duration of the time window starting at --timestamp-from,
+	alternative to --timestamp-to. Examples: 6h, 2d, 1w`)
+	cmd.Flags().String("timezone", "UTC", `Time zone of the --timestamp-from/to and --modified-since/before
+	values without explicit offset. Examples: UTC, Europe/Zurich`)
+	cmd.Flags().Int64("sqs-message-records", defaultSqsMessageRecords, `Number of s3 records added to one
 	SQS message. (max 100)`)
-	partitionCmd.Flags().Int64("sqs-batch-size", defaultSqsBatchSize, `Number of SQS messages published in one SQS batch.
+	cmd.Flags().Int64("sqs-batch-size", defaultSqsBatchSize, `Number of SQS messages published in one SQS batch.
 	(max 10)`)
-	partitionCmd.Flags().BoolP("dry-run", "d", false, "Fetch files without publishing to queue.")
+	addSqsFifoFlags(cmd)
+	cmd.Flags().BoolP("dry-run", "d", false, "Fetch files without publishing to queue.")
+	cmd.Flags().Int64("min-size", 0, "Source-files smaller than this size (in bytes) are skipped.")
+	cmd.Flags().Int64("max-size", 0, "Source-files bigger than this size (in bytes) are skipped. (0 = no limit)")
+	cmd.Flags().String("modified-since", "", `Source-files last modified before this time are skipped.
+	Same formats as --timestamp-from`)
+	cmd.Flags().String("modified-before", "", `Source-files last modified at OR after this time are skipped.
+	Same formats as --timestamp-from`)
+	cmd.Flags().StringSlice("exclude-storage-class", []string{"GLACIER", "DEEP_ARCHIVE"}, `Source-files with
+	one of these storage classes are skipped (archived objects cannot be read by the partitioning).`)
+	cmd.Flags().String("state-file", "", `Local state file used to skip files already partitioned
+	(same key and ETag). Disabled if empty.`)
+	cmd.Flags().Bool("force", false, "Partition files even if already partitioned according to the state file.")
+	cmd.Flags().Bool("skip-preflight", false, "Skip the configuration and permission checks (see doctor command).")
+	cmd.Flags().Float64("sample", 1, `Fraction of the source-files partitioned, selected by a hash of the key so
+	that the same files are selected on each run. Example: 0.01 for 1%`)
+	cmd.Flags().String("shard", "", `Only partition the shard i of n (1 <= i <= n) of the source-files, selected by
+	a hash of the key. The n shards don't overlap. Example: 2/4`)
+	cmd.Flags().Int("limit", 0, `Maximum number of source-files partitioned, files already partitioned
+	according to the state file are not counted. (0 = no limit)`)
 }
 
-//-----------------------------------------------------------------------------
+// Adds the FIFO queue flags used by setSqsFifoConfig to the command
+func addSqsFifoFlags(cmd *cobra.Command) {
+	cmd.Flags().String("sqs-group-by", sqsGroupByPrefix, `FIFO queue only: message group of the s3 records.
+	One of ['prefix', 'hour', 'prefix-hour', 'bucket']`)
+	cmd.Flags().String("sqs-deduplication", sqsDeduplicationKeyHash, `FIFO queue only: message deduplication id.
+	One of ['key-hash' (hash of the bucket and keys), 'content' (hash of the message or queue content based
+	deduplication)]`)
+}
 
-func runPartition(partitionConfig partitionConfig, ch chan metrics) error {
-	context := context.Background()
+//-----------------------------------------------------------------------------
 
-	awsConfig, err := config.LoadDefaultConfig(
-		context,
-		config.WithRegion(partitionConfig.AwsRegion),
-		config.WithSharedConfigProfile(partitionConfig.AwsProfile),
-	)
+// Partition the keys of the config, state is optional (nil) and the metrics are sent
+// to the channel for each page of keys. The partitioning stops when the context is done.
+func runPartition(ctx context.Context, partitionConfig partitionConfig, state *StateStore, ch chan metrics) error {
+	awsConfig, err := newAwsConfig(ctx, partitionConfig)
 	if err != nil {
 		return err
 	}
 
-	s3Basics := NewS3Basics(context, awsConfig)
-	sqsBasics := NewSqsBasics(context, awsConfig)
+	s3Basics := NewS3Basics(ctx, awsConfig)
+	sqsBasics := NewSqsBasics(ctx, awsConfig)
+
+	err = sqsBasics.SetQueueType(&partitionConfig)
+	if err != nil {
+		return err
+	}
 
 	// Get 3s list paginator
 	paginator := s3Basics.GetListObjectsPaginator(partitionConfig)
 
-	for paginator.HasMorePages() {
+	selected := 0
+	for paginator.HasMorePages() && !limitReached(partitionConfig, selected) {
 		m := metrics{}
 		m.Counters.Pages++
 		ts := time.Now()
-		page, e := paginator.NextPage(context)
+		page, e := paginator.NextPage(ctx)
 		if e != nil {
 			return e
 		}
@@ -132,12 +208,28 @@ func runPartition(partitionConfig partitionConfig, ch chan metrics) error {
 		if e != nil {
 			return e
 		}
-		m.Counters.Files.Skipped += len(page.Contents) - len(keys)
+		m.Counters.Files.Skipped += len(page.Contents) - len(keys) - m.filteredFiles() - m.sampledOutFiles()
+
+		etags := getETags(page.Contents)
+		if state != nil && !partitionConfig.Force {
+			keys, e = removePartitionedKeys(state, partitionConfig.S3Bucket, keys, etags, &m)
+			if e != nil {
+				return e
+			}
+		}
+		keys = applyLimit(keys, partitionConfig.Limit, selected, &m)
+		selected += len(keys)
 		m.Durations.GetKeysToPartition += time.Since(ts)
 
 		ts = time.Now()
 		if !partitionConfig.DryRun {
-			err = sqsBasics.PublishKeys(partitionConfig, keys, &m)
+			var onPublished publishedFunc
+			if state != nil {
+				onPublished = func(published []string) error {
+					return state.MarkPartitioned(partitionConfig.S3Bucket, published, etags)
+				}
+			}
+			err = sqsBasics.PublishKeys(partitionConfig, selectObjects(page.Contents, keys), &m, onPublished)
 			if err != nil {
 				return err
 			}
@@ -175,7 +267,9 @@ func getKeysToPartition(contents []types.Object, conf *partitionConfig, metrics
 			timeFrom := conf.TimeFrom
 			timeTo := conf.TimeTo
 			if (timeFrom.IsZero() || timeFrom.Equal(timestamp) || timeFrom.Before(timestamp)) &&
-				(timeTo.IsZero() || timeTo.After(timestamp)) {
+				(timeTo.IsZero() || timeTo.After(timestamp)) &&
+				matchObjectFilters(obj, conf, metrics) &&
+				matchSampling(key, conf, metrics) {
 				keys = append(keys, key)
 			}
 		case strings.HasSuffix(key, "/"): // Prefix
@@ -190,6 +284,118 @@ func getKeysToPartition(contents []types.Object, conf *partitionConfig, metrics
 	return keys, nil
 }
 
+// Returns false if the object is excluded by one of the object metadata filters
+// (size, last modified and storage class), the corresponding metrics counter is
+// incremented.
+func matchObjectFilters(obj types.Object, conf *partitionConfig, metrics *metrics) bool {
+	size := aws.ToInt64(obj.Size)
+	if size < conf.MinSize || (conf.MaxSize > 0 && size > conf.MaxSize) {
+		metrics.Counters.Files.Filtered.Size++
+		return false
+	}
+
+	lastModified := aws.ToTime(obj.LastModified)
+	if (!conf.ModifiedSince.IsZero() && lastModified.Before(conf.ModifiedSince)) ||
+		(!conf.ModifiedBefore.IsZero() && !lastModified.Before(conf.ModifiedBefore)) {
+		metrics.Counters.Files.Filtered.LastModified++
+		return false
+	}
+
+	if slices.Contains(conf.ExcludedClasses, string(obj.StorageClass)) {
+		metrics.Counters.Files.Filtered.StorageClass++
+		return false
+	}
+
+	return true
+}
+
+// Returns false if the key is not part of the shard or of the sample, the corresponding
+// metrics counter is incremented. The selection only depends on the key so that a run
+// can be repeated or split over several machines.
+func matchSampling(key string, conf *partitionConfig, metrics *metrics) bool {
+	if conf.ShardCount > 1 && keyHash("shard", key)%uint64(conf.ShardCount) != uint64(conf.ShardIndex-1) {
+		metrics.Counters.Files.SampledOut.Shard++
+		return false
+	}
+
+	// Use the 53 upper bits of the hash as a uniform value in [0, 1)
+	if conf.SampleFraction > 0 && conf.SampleFraction < 1 &&
+		float64(keyHash("sample", key)>>11)/(1<<53) >= conf.SampleFraction {
+		metrics.Counters.Files.SampledOut.Sample++
+		return false
+	}
+
+	return true
+}
+
+// Returns the FNV-1a hash of the key, salted so that shards and samples are independent
+func keyHash(salt, key string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(salt + ":" + key))
+	return h.Sum64()
+}
+
+// Returns the keys within the --limit, selected is the number of keys already selected
+// by the previous pages.
+func applyLimit(keys []string, limit, selected int, metrics *metrics) []string {
+	if limit <= 0 || selected+len(keys) <= limit {
+		return keys
+	}
+	remaining := max(limit-selected, 0)
+	metrics.Counters.Files.SampledOut.Limit += len(keys) - remaining
+	return keys[:remaining]
+}
+
+func limitReached(conf partitionConfig, selected int) bool {
+	return conf.Limit > 0 && selected >= conf.Limit
+}
+
+// Returns the objects of the keys
+func selectObjects(contents []types.Object, keys []string) []types.Object {
+	selected := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		selected[key] = true
+	}
+	objects := make([]types.Object, 0, len(keys))
+	for _, obj := range contents {
+		if selected[*obj.Key] {
+			objects = append(objects, obj)
+		}
+	}
+	return objects
+}
+
+func getETags(contents []types.Object) map[string]string {
+	etags := make(map[string]string, len(contents))
+	for _, obj := range contents {
+		etags[*obj.Key] = aws.ToString(obj.ETag)
+	}
+	return etags
+}
+
+// Remove the keys that have already been partitioned with the same ETag
+func removePartitionedKeys(
+	state *StateStore,
+	bucket string,
+	keys []string,
+	etags map[string]string,
+	metrics *metrics,
+) ([]string, error) {
+	remaining := []string{}
+	for _, key := range keys {
+		partitioned, err := state.IsPartitioned(bucket, key, etags[key])
+		if err != nil {
+			return []string{}, err
+		}
+		if partitioned {
+			metrics.Counters.Files.AlreadyPartitioned++
+			continue
+		}
+		remaining = append(remaining, key)
+	}
+	return remaining, nil
+}
+
 func parseTimestamp(tsString string) (time.Time, error) {
 	layouts := []string{
 		"2006-01-02-15",
@@ -1,7 +1,12 @@
 package cmd
 
 import (
+	"fmt"
 	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -38,3 +43,109 @@ func TestParseTimestamp(t *testing.T) {
 		assert.Equal(t, test.expected, output.String())
 	}
 }
+
+func TestGetKeysToPartitionObjectFilters(t *testing.T) {
+	modified := time.Date(2025, 4, 25, 10, 0, 0, 0, time.UTC)
+	contents := []types.Object{
+		{Key: aws.String("prefix/"), Size: aws.Int64(0)},
+		{Key: aws.String("prefix/E1.2025-04-24-14.a.gz"), Size: aws.Int64(100), LastModified: &modified},
+		{Key: aws.String("prefix/E1.2025-04-24-14.b.gz"), Size: aws.Int64(5), LastModified: &modified},
+		{
+			Key:          aws.String("prefix/E1.2025-04-24-15.c.gz"),
+			Size:         aws.Int64(100),
+			LastModified: &modified,
+			StorageClass: types.ObjectStorageClassGlacier,
+		},
+		{
+			Key:          aws.String("prefix/E1.2025-04-24-16.d.gz"),
+			Size:         aws.Int64(100),
+			LastModified: aws.Time(modified.Add(time.Hour)),
+		},
+		{Key: aws.String("prefix/E1.2025-04-26-16.e.gz"), Size: aws.Int64(1), LastModified: &modified},
+	}
+	conf := partitionConfig{
+		TimeTo:          time.Date(2025, 4, 26, 0, 0, 0, 0, time.UTC),
+		MinSize:         10,
+		ModifiedBefore:  modified.Add(time.Hour),
+		ExcludedClasses: []string{"GLACIER"},
+	}
+	m := metrics{}
+
+	keys, err := getKeysToPartition(contents, &conf, &m)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"prefix/E1.2025-04-24-14.a.gz"}, keys)
+	assert.Equal(t, 1, m.Counters.Files.Filtered.Size)
+	assert.Equal(t, 1, m.Counters.Files.Filtered.LastModified)
+	assert.Equal(t, 1, m.Counters.Files.Filtered.StorageClass)
+	assert.Equal(t, 3, m.filteredFiles())
+}
+
+func TestGetKeysToPartitionShards(t *testing.T) {
+	contents := []types.Object{}
+	for i := range 100 {
+		key := fmt.Sprintf("prefix/E1.2025-04-24-14.%03d.gz", i)
+		contents = append(contents, types.Object{Key: aws.String(key), Size: aws.Int64(100)})
+	}
+
+	// The shards are disjoint and cover all keys
+	all := []string{}
+	for i := 1; i <= 3; i++ {
+		conf := partitionConfig{SampleFraction: 1, ShardIndex: i, ShardCount: 3}
+		m := metrics{}
+		keys, err := getKeysToPartition(contents, &conf, &m)
+		require.NoError(t, err)
+		assert.NotEmpty(t, keys)
+		assert.Equal(t, 100-len(keys), m.Counters.Files.SampledOut.Shard)
+		for _, key := range keys {
+			assert.NotContains(t, all, key)
+		}
+		all = append(all, keys...)
+	}
+	assert.Len(t, all, 100)
+}
+
+func TestGetKeysToPartitionSample(t *testing.T) {
+	contents := []types.Object{}
+	for i := range 1000 {
+		key := fmt.Sprintf("prefix/E1.2025-04-24-14.%04d.gz", i)
+		contents = append(contents, types.Object{Key: aws.String(key), Size: aws.Int64(100)})
+	}
+	conf := partitionConfig{SampleFraction: 0.1, ShardCount: 1}
+
+	m := metrics{}
+	keys, err := getKeysToPartition(contents, &conf, &m)
+	require.NoError(t, err)
+	assert.InDelta(t, 100, len(keys), 40)
+	assert.Equal(t, 1000-len(keys), m.Counters.Files.SampledOut.Sample)
+	assert.Equal(t, 0, m.filteredFiles())
+
+	// The sample is deterministic
+	again, err := getKeysToPartition(contents, &conf, &metrics{})
+	require.NoError(t, err)
+	assert.Equal(t, keys, again)
+}
+
+func TestApplyLimit(t *testing.T) {
+	m := metrics{}
+	keys := []string{"a", "b", "c"}
+	assert.Equal(t, keys, applyLimit(keys, 0, 10, &m))
+	assert.Equal(t, keys, applyLimit(keys, 5, 2, &m))
+	assert.Equal(t, []string{"a"}, applyLimit(keys, 5, 4, &m))
+	assert.Empty(t, applyLimit(keys, 5, 5, &m))
+	assert.Equal(t, 5, m.Counters.Files.SampledOut.Limit)
+}
+
+func TestParseShard(t *testing.T) {
+	i, n, err := parseShard("")
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 1}, []int{i, n})
+
+	i, n, err = parseShard("2/4")
+	require.NoError(t, err)
+	assert.Equal(t, []int{2, 4}, []int{i, n})
+
+	for _, shard := range []string{"2", "0/4", "5/4", "a/4", "1/b", "1/0"} {
+		_, _, err = parseShard(shard)
+		assert.Error(t, err, shard)
+	}
+}
@@ -0,0 +1,243 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
+	"github.com/spf13/cobra"
+)
+
+// AWS API calls used by the pre-flight checks
+type preflightSTSAPI interface {
+	GetCallerIdentity(ctx context.Context, params *sts.GetCallerIdentityInput, optFns ...func(*sts.Options)) (
+		*sts.GetCallerIdentityOutput, error)
+}
+
+type preflightS3API interface {
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (
+		*s3.ListObjectsV2Output, error)
+	GetBucketLocation(ctx context.Context, params *s3.GetBucketLocationInput, optFns ...func(*s3.Options)) (
+		*s3.GetBucketLocationOutput, error)
+}
+
+type preflightSQSAPI interface {
+	GetQueueAttributes(ctx context.Context, params *sqs.GetQueueAttributesInput, optFns ...func(*sqs.Options)) (
+		*sqs.GetQueueAttributesOutput, error)
+	SendMessageBatch(ctx context.Context, params *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (
+		*sqs.SendMessageBatchOutput, error)
+}
+
+// preflightCheck is the result of one pre-flight check, a check with a warning doesn't fail
+// the pre-flight
+type preflightCheck struct {
+	Name    string
+	Detail  string
+	Err     error
+	Warning bool
+}
+
+// doctor subcommand
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the configuration and the AWS permissions needed for the partitioning",
+	Long: `Check the AWS credentials, the s3:ListBucket permission on the bucket/prefix, the bucket
+region, the sqs:GetQueueAttributes and sqs:SendMessage permissions on the queue and report all
+issues at once. The same checks are run before partitioning, unless --skip-preflight is set.
+
+The bucket region check needs s3:GetBucketLocation, which is not needed by the partitioning: if
+it is denied the check is only a warning.
+
+The sqs:SendMessage check is best-effort: it sends an empty batch, which is rejected by SQS
+without sending any message. A denied permission is only detected if SQS checks the permission
+before validating the batch, so an OK result doesn't guarantee that sending is allowed. The
+check is skipped with --dry-run, which doesn't send messages.
+
+Examples:
+	cloudfront-logs doctor --profile swisstopo-bgdi-dev --bucket swisstopo-bgdi-dev-cloudfront-logs-v2 \
+	--prefix sys-data.dev.bgdi.ch
+`,
+	Args: cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		conf, err := newBaseConfig(cmd)
+		if err != nil {
+			return err
+		}
+		conf.S3Prefix = cmd.Flag("prefix").Value.String()
+		return runPreflight(context.Background(), conf)
+	},
+}
+
+//-----------------------------------------------------------------------------
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+
+	doctorCmd.Flags().StringP("prefix", "p", "", "Prefix of s3 files to check the listing permission on.")
+}
+
+//-----------------------------------------------------------------------------
+
+// Runs the pre-flight checks of the config, prints them and returns an error with all
+// the issues found.
+func runPreflight(ctx context.Context, conf partitionConfig) error {
+	awsConfig, err := newAwsConfig(ctx, conf)
+	if err != nil {
+		return fmt.Errorf("pre-flight: invalid AWS credentials: %w", err)
+	}
+
+	checks := preflightChecks(
+		ctx,
+		conf,
+		sts.NewFromConfig(awsConfig),
+		s3.NewFromConfig(awsConfig),
+		sqs.NewFromConfig(awsConfig),
+	)
+	printPreflight(checks)
+	return preflightError(checks)
+}
+
+// Name of the sqs:SendMessage check, which is not reliable (see doctor help)
+const sendMessageCheckName = "sqs:SendMessage (best-effort)"
+
+// Runs all the checks, even if some of them fail
+func preflightChecks(
+	ctx context.Context,
+	conf partitionConfig,
+	stsClient preflightSTSAPI,
+	s3Client preflightS3API,
+	sqsClient preflightSQSAPI,
+) []preflightCheck {
+	checks := []preflightCheck{}
+
+	check := preflightCheck{Name: "AWS credentials"}
+	identity, err := stsClient.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		check.Err = err
+	} else {
+		check.Detail = fmt.Sprintf("%s (account %s)", aws.ToString(identity.Arn), aws.ToString(identity.Account))
+	}
+	checks = append(checks, check)
+
+	check = preflightCheck{Name: "s3:ListBucket", Detail: fmt.Sprintf("s3://%s/%s", conf.S3Bucket, conf.S3Prefix)}
+	params := &s3.ListObjectsV2Input{Bucket: &conf.S3Bucket, MaxKeys: aws.Int32(1)}
+	if conf.S3Prefix != "" {
+		params.Prefix = &conf.S3Prefix
+	}
+	_, check.Err = s3Client.ListObjectsV2(ctx, params)
+	checks = append(checks, check)
+
+	checks = append(checks, checkBucketRegion(ctx, conf, s3Client))
+	checks = append(checks, checkQueueRegion(conf))
+
+	check = preflightCheck{Name: "sqs:GetQueueAttributes", Detail: conf.SqsQueueURL}
+	_, check.Err = sqsClient.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       &conf.SqsQueueURL,
+		AttributeNames: []sqstypes.QueueAttributeName{sqstypes.QueueAttributeNameQueueArn},
+	})
+	checks = append(checks, check)
+
+	if conf.DryRun {
+		return checks
+	}
+	check = preflightCheck{Name: sendMessageCheckName, Detail: conf.SqsQueueURL}
+	_, err = sqsClient.SendMessageBatch(ctx, &sqs.SendMessageBatchInput{
+		QueueUrl: &conf.SqsQueueURL,
+		Entries:  []sqstypes.SendMessageBatchRequestEntry{},
+	})
+	var emptyBatch *sqstypes.EmptyBatchRequest
+	if err == nil || !errors.As(err, &emptyBatch) {
+		// The empty batch is only rejected as empty if the send is allowed
+		check.Err = err
+		if err == nil {
+			check.Err = errors.New("empty batch unexpectedly accepted")
+		}
+	}
+	checks = append(checks, check)
+
+	return checks
+}
+
+func checkBucketRegion(ctx context.Context, conf partitionConfig, s3Client preflightS3API) preflightCheck {
+	check := preflightCheck{Name: "Bucket region", Detail: conf.S3Bucket}
+	location, err := s3Client.GetBucketLocation(ctx, &s3.GetBucketLocationInput{Bucket: &conf.S3Bucket})
+	if err != nil {
+		check.Err = err
+		// s3:GetBucketLocation is only needed by this check
+		var apiErr smithy.APIError
+		check.Warning = errors.As(err, &apiErr) && apiErr.ErrorCode() == "AccessDenied"
+		return check
+	}
+
+	// See https://docs.aws.amazon.com/AmazonS3/latest/API/API_GetBucketLocation.html
+	region := string(location.LocationConstraint)
+	switch region {
+	case "":
+		region = "us-east-1"
+	case "EU":
+		region = "eu-west-1"
+	}
+	check.Detail = fmt.Sprintf("%s in %s", conf.S3Bucket, region)
+	if region != conf.AwsRegion {
+		check.Err = fmt.Errorf("bucket region %s doesn't match the region %s", region, conf.AwsRegion)
+	}
+	return check
+}
+
+// Checks that the queue URL (https://sqs.<region>.amazonaws.com/<account>/<name>) is in the
+// region of the config
+func checkQueueRegion(conf partitionConfig) preflightCheck {
+	check := preflightCheck{Name: "Queue region", Detail: conf.SqsQueueURL}
+	queueURL, err := url.Parse(conf.SqsQueueURL)
+	if err != nil {
+		check.Err = err
+		return check
+	}
+	parts := strings.Split(queueURL.Hostname(), ".")
+	if len(parts) < 3 || parts[0] != "sqs" {
+		check.Err = fmt.Errorf("invalid queue URL %s", conf.SqsQueueURL)
+		return check
+	}
+	if parts[1] != conf.AwsRegion {
+		check.Err = fmt.Errorf("queue region %s doesn't match the region %s", parts[1], conf.AwsRegion)
+	}
+	return check
+}
+
+func printPreflight(checks []preflightCheck) {
+	for _, check := range checks {
+		status := "OK"
+		switch {
+		case check.Err != nil && check.Warning:
+			status = "WARN"
+		case check.Err != nil:
+			status = "FAILED"
+		}
+		fmt.Printf("%-30s %-6s %s\n", check.Name, status, check.Detail)
+		if check.Err != nil {
+			fmt.Printf("%-30s        %s\n", "", check.Err)
+		}
+	}
+}
+
+// Returns an error with all the failed checks, nil if all checks passed
+func preflightError(checks []preflightCheck) error {
+	failed := []string{}
+	for _, check := range checks {
+		if check.Err != nil && !check.Warning {
+			failed = append(failed, check.Name)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("pre-flight checks failed: %s", strings.Join(failed, ", "))
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakePreflightClient struct {
+	identityErr error
+	listErr     error
+	location    s3types.BucketLocationConstraint
+	locationErr error
+	sendErr     error
+}
+
+func (f fakePreflightClient) GetCallerIdentity(
+	_ context.Context, _ *sts.GetCallerIdentityInput, _ ...func(*sts.Options),
+) (*sts.GetCallerIdentityOutput, error) {
+	return &sts.GetCallerIdentityOutput{Arn: aws.String("arn:aws:iam::123:user/me"), Account: aws.String("123")},
+		f.identityErr
+}
+
+func (f fakePreflightClient) ListObjectsV2(
+	_ context.Context, _ *s3.ListObjectsV2Input, _ ...func(*s3.Options),
+) (*s3.ListObjectsV2Output, error) {
+	return &s3.ListObjectsV2Output{}, f.listErr
+}
+
+func (f fakePreflightClient) GetBucketLocation(
+	_ context.Context, _ *s3.GetBucketLocationInput, _ ...func(*s3.Options),
+) (*s3.GetBucketLocationOutput, error) {
+	return &s3.GetBucketLocationOutput{LocationConstraint: f.location}, f.locationErr
+}
+
+func (f fakePreflightClient) GetQueueAttributes(
+	_ context.Context, _ *sqs.GetQueueAttributesInput, _ ...func(*sqs.Options),
+) (*sqs.GetQueueAttributesOutput, error) {
+	return &sqs.GetQueueAttributesOutput{}, nil
+}
+
+func (f fakePreflightClient) SendMessageBatch(
+	_ context.Context, _ *sqs.SendMessageBatchInput, _ ...func(*sqs.Options),
+) (*sqs.SendMessageBatchOutput, error) {
+	return nil, f.sendErr
+}
+
+func TestPreflightChecks(t *testing.T) {
+	conf := partitionConfig{
+		AwsRegion:   "eu-central-1",
+		S3Bucket:    "bucket",
+		SqsQueueURL: "https://sqs.eu-central-1.amazonaws.com/123/queue",
+	}
+
+	client := fakePreflightClient{location: "eu-central-1", sendErr: &sqstypes.EmptyBatchRequest{}}
+	checks := preflightChecks(context.Background(), conf, client, client, client)
+	require.NoError(t, preflightError(checks))
+	assert.Equal(t, "arn:aws:iam::123:user/me (account 123)", checks[0].Detail)
+
+	// All the issues are reported
+	client = fakePreflightClient{
+		identityErr: errors.New("expired token"),
+		listErr:     errors.New("access denied"),
+		location:    "EU",
+		sendErr:     errors.New("access denied"),
+	}
+	conf.SqsQueueURL = "https://sqs.eu-west-1.amazonaws.com/123/queue"
+	checks = preflightChecks(context.Background(), conf, client, client, client)
+	err := preflightError(checks)
+	require.Error(t, err)
+	assert.Equal(t, "pre-flight checks failed: AWS credentials, s3:ListBucket, Bucket region, Queue region, "+
+		"sqs:SendMessage (best-effort)", err.Error())
+}
+
+func TestPreflightChecksOptionalPermissions(t *testing.T) {
+	conf := partitionConfig{
+		AwsRegion:   "eu-central-1",
+		S3Bucket:    "bucket",
+		SqsQueueURL: "https://sqs.eu-central-1.amazonaws.com/123/queue",
+		DryRun:      true,
+	}
+
+	// s3:GetBucketLocation is not needed by the partitioning and no message is sent in dry run
+	client := fakePreflightClient{
+		locationErr: &smithy.GenericAPIError{Code: "AccessDenied"},
+		sendErr:     errors.New("access denied"),
+	}
+	checks := preflightChecks(context.Background(), conf, client, client, client)
+	require.NoError(t, preflightError(checks))
+	assert.True(t, checks[2].Warning)
+	for _, check := range checks {
+		assert.NotEqual(t, sendMessageCheckName, check.Name)
+	}
+
+	// Other errors of the bucket region still fail
+	client.locationErr = &smithy.GenericAPIError{Code: "NoSuchBucket"}
+	checks = preflightChecks(context.Background(), conf, client, client, client)
+	assert.EqualError(t, preflightError(checks), "pre-flight checks failed: Bucket region")
+}
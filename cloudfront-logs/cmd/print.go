@@ -12,11 +12,14 @@ func printStart(conf partitionConfig, timeStart time.Time) {
 	lineSeparator := strings.Repeat("-", numberOfSeparatorChars)
 	fmt.Println(lineSeparator)
 	fmt.Printf("%s - Cloudfront logs partitioning starting\n\n", timeStart.Format("2006-01-02 15:04:05"))
+	fmt.Printf("Effective UTC window: %s\n", formatTimeWindow(conf.TimeFrom, conf.TimeTo))
 	if conf.Verbose {
 		fmt.Printf(`
 Config:
     AWS-Profile        : %s
     AWS-Region         : %s
+    AWS-No-Profile     : %t
+    AWS-Role-ARN       : %s
     S3-Bucket          : %s
     S3-Max-Keys        : %d
     S3-Object-Delimiter: %s
@@ -24,12 +27,27 @@ Config:
     SQS-Queue-URL      : %s
     SQS-Batch-Size     : %d
     SQS-MessageRecords : %d
+    SQS-Group-By       : %s (FIFO queue only)
+    SQS-Deduplication  : %s (FIFO queue only)
+    Time-Zone          : %s
     Timestamp-From     : %s
     Timestamp-To       : %s
+    Min-Size           : %d
+    Max-Size           : %d
+    Modified-Since     : %s
+    Modified-Before    : %s
+    Excluded-Classes   : %s
+    Sample             : %g
+    Shard              : %d/%d
+    Limit              : %d
+    State-File         : %s
+    Force              : %t
 
 `,
 			conf.AwsProfile,
 			conf.AwsRegion,
+			conf.AwsNoProfile,
+			conf.AwsRoleArn,
 			conf.S3Bucket,
 			conf.S3MaxKeys,
 			conf.S3ObjectDelimiter,
@@ -37,24 +55,57 @@ Config:
 			conf.SqsQueueURL,
 			conf.SqsBatchSize,
 			conf.SqsMessageRecords,
+			conf.SqsGroupBy,
+			conf.SqsDeduplication,
+			conf.TimeZone.String(),
 			conf.TimeFrom.String(),
 			conf.TimeTo.String(),
+			conf.MinSize,
+			conf.MaxSize,
+			conf.ModifiedSince.String(),
+			conf.ModifiedBefore.String(),
+			strings.Join(conf.ExcludedClasses, ","),
+			conf.SampleFraction,
+			conf.ShardIndex,
+			conf.ShardCount,
+			conf.Limit,
+			conf.StateFile,
+			conf.Force,
 		)
 	}
 	fmt.Println(lineSeparator)
 }
 
+// Returns the time window as [from, to) in UTC, open bounds are shown as "-"
+func formatTimeWindow(from, to time.Time) string {
+	format := func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return t.UTC().Format("2006-01-02 15:04 MST")
+	}
+	window := fmt.Sprintf("[%s, %s)", format(from), format(to))
+	if !from.IsZero() && !to.IsZero() {
+		window += fmt.Sprintf(" (%d hours)", int(to.Sub(from).Hours()))
+	}
+	return window
+}
+
 func printProgress(metrics *metrics) {
 	fmt.Print("\033[s") // save the cursor position
 
 	fmt.Print("\033[G\033[K") // move the cursor left and clear the line
-	fmt.Printf("%s - %3d prefixes, %5d pages, %8d files-fetched, %8d files-partitioned, %8d files-skipped, Duration: %s",
+	fmt.Printf("%s - %3d prefixes, %5d pages, %8d files-fetched, %8d files-partitioned, %8d files-skipped, "+
+		"%8d files-already-partitioned, %8d files-filtered, %8d files-sampled-out, Duration: %s",
 		time.Now().Format("2006-01-02 15:04:05"),
 		len(metrics.Prefixes),
 		metrics.Counters.Pages,
 		metrics.Counters.Files.Fetched,
 		metrics.Counters.Files.Partitioned,
 		metrics.Counters.Files.Skipped,
+		metrics.Counters.Files.AlreadyPartitioned,
+		metrics.filteredFiles(),
+		metrics.sampledOutFiles(),
 		time.Since(metrics.Timestamps.Start).Round(time.Millisecond),
 	)
 }
@@ -77,6 +128,13 @@ func printEnd(metrics metrics, verbose bool) {
 		Files-fetched              : %8d
 		Files-partitioned          : %8d
 		Files-skipped              : %8d
+		Files-already-partitioned  : %8d
+		Files-filtered-size        : %8d
+		Files-filtered-modified    : %8d
+		Files-filtered-class       : %8d
+		Files-sampled-out-shard    : %8d
+		Files-sampled-out-sample   : %8d
+		Files-sampled-out-limit    : %8d
 
 	Durations:
 		Fetch keys                 : %8s
@@ -90,6 +148,13 @@ func printEnd(metrics metrics, verbose bool) {
 			metrics.Counters.Files.Fetched,
 			metrics.Counters.Files.Partitioned,
 			metrics.Counters.Files.Skipped,
+			metrics.Counters.Files.AlreadyPartitioned,
+			metrics.Counters.Files.Filtered.Size,
+			metrics.Counters.Files.Filtered.LastModified,
+			metrics.Counters.Files.Filtered.StorageClass,
+			metrics.Counters.Files.SampledOut.Shard,
+			metrics.Counters.Files.SampledOut.Sample,
+			metrics.Counters.Files.SampledOut.Limit,
 			metrics.Durations.Total.Round(time.Millisecond),
 			metrics.Durations.GetKeysToPartition.Round(time.Millisecond),
 			metrics.Durations.BuildSqsPayload.Round(time.Millisecond),
@@ -103,3 +168,49 @@ func printEnd(metrics metrics, verbose bool) {
 
 	fmt.Println(lineSeparator)
 }
+
+func printBatchEnd(results []*batchResult, duration time.Duration) {
+	lineSeparator := strings.Repeat("-", numberOfSeparatorChars)
+
+	fmt.Println(lineSeparator)
+	fmt.Printf("%s - Batch partitioning done in %s\n\n",
+		time.Now().Format("2006-01-02 15:04:05"),
+		duration.Round(time.Millisecond),
+	)
+	fmt.Printf("%-20s %-20s %8s %8s %12s %12s %8s %12s  %s\n",
+		"Job", "Profile", "Prefixes", "Pages", "Fetched", "Partitioned", "Skipped", "Duration", "Status")
+
+	failed := 0
+	for _, result := range results {
+		status := "OK"
+		if result.Err != nil {
+			status = "FAILED"
+			failed++
+		}
+		fmt.Printf("%-20s %-20s %8d %8d %12d %12d %8d %12s  %s\n",
+			result.Job.Name,
+			result.Config.AwsProfile,
+			len(result.Metrics.Prefixes),
+			result.Metrics.Counters.Pages,
+			result.Metrics.Counters.Files.Fetched,
+			result.Metrics.Counters.Files.Partitioned,
+			result.Metrics.Counters.Files.Skipped+
+				result.Metrics.Counters.Files.AlreadyPartitioned+
+				result.Metrics.filteredFiles()+
+				result.Metrics.sampledOutFiles(),
+			result.Metrics.Durations.Total.Round(time.Millisecond),
+			status,
+		)
+	}
+
+	if failed > 0 {
+		fmt.Printf("\n%d/%d jobs failed:\n", failed, len(results))
+		for _, result := range results {
+			if result.Err != nil {
+				fmt.Printf("\t%s: %s\n", result.Job.Name, result.Err)
+			}
+		}
+	}
+
+	fmt.Println(lineSeparator)
+}
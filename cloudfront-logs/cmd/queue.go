@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const defaultQueueInterval = 10 * time.Second
+
+// queue subcommand
+var queueCmd = &cobra.Command{
+	Use:   "queue",
+	Short: "Show the partitioning queue status and optionally wait until it is drained",
+	Long: `Show the number of messages of the partitioning queue (available, in-flight and delayed)
+and of its dead-letter queue.
+
+With --wait the queue is polled until it is drained, with an ETA estimated from the observed
+consumption rate. The command fails if the dead-letter queue grows while waiting.
+
+Examples:
+	cloudfront-logs queue --profile swisstopo-bgdi-dev
+
+	cloudfront-logs queue --profile swisstopo-bgdi-dev --wait --interval 30s
+`,
+	Args: cobra.ExactArgs(0),
+	PreRun: func(cmd *cobra.Command, _ []string) {
+		// The queue only depends on the profile
+		unmarkRequiredFlags(cmd, "bucket")
+	},
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		conf, err := newBaseConfig(cmd)
+		if err != nil {
+			return err
+		}
+		wait, err := cmd.Flags().GetBool("wait")
+		if err != nil {
+			return err
+		}
+		interval, err := getQueueIntervalFlag(cmd)
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		awsConfig, err := newAwsConfig(ctx, conf)
+		if err != nil {
+			return err
+		}
+		sqsBasics := NewSqsBasics(ctx, awsConfig)
+
+		dlqURL, err := sqsBasics.GetDeadLetterQueueURL(conf.SqsQueueURL)
+		if err != nil {
+			return err
+		}
+
+		stats, dlqStats, err := getQueuesStats(sqsBasics, conf.SqsQueueURL, dlqURL)
+		if err != nil {
+			return err
+		}
+		printQueueStats(conf.SqsQueueURL, stats, dlqURL, dlqStats)
+
+		if !wait {
+			return nil
+		}
+		getStats := func() (QueueStats, QueueStats, error) {
+			return getQueuesStats(sqsBasics, conf.SqsQueueURL, dlqURL)
+		}
+		return waitForQueue(ctx, getStats, stats, dlqStats, interval)
+	},
+}
+
+//-----------------------------------------------------------------------------
+
+func init() {
+	rootCmd.AddCommand(queueCmd)
+
+	queueCmd.Flags().BoolP("wait", "w", false, "Wait until the queue is drained")
+	queueCmd.Flags().Duration("interval", defaultQueueInterval, "Interval between two queue status checks with --wait")
+}
+
+//-----------------------------------------------------------------------------
+
+// Returns the --interval flag, it must be positive
+func getQueueIntervalFlag(cmd *cobra.Command) (time.Duration, error) {
+	interval, err := cmd.Flags().GetDuration("interval")
+	if err != nil {
+		return 0, err
+	}
+	if interval <= 0 {
+		return 0, fmt.Errorf("invalid --interval %s, must be > 0", interval)
+	}
+	return interval, nil
+}
+
+// Returns the stats of the queue and of its dead-letter queue (empty if no dead-letter queue)
+func getQueuesStats(sqsBasics *SqsBasics, queueURL, dlqURL string) (QueueStats, QueueStats, error) {
+	stats, err := sqsBasics.GetQueueStats(queueURL)
+	if err != nil {
+		return stats, QueueStats{}, err
+	}
+	if dlqURL == "" {
+		return stats, QueueStats{}, nil
+	}
+	dlqStats, err := sqsBasics.GetQueueStats(dlqURL)
+	return stats, dlqStats, err
+}
+
+// Polls the queue and dead-letter queue stats with getStats until the queue is drained,
+// fails if the dead-letter queue grows
+func waitForQueue(
+	ctx context.Context,
+	getStats func() (QueueStats, QueueStats, error),
+	initial QueueStats,
+	initialDlq QueueStats,
+	interval time.Duration,
+) error {
+	timeStart := time.Now()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	stats := initial
+	for stats.Total() > 0 {
+		select {
+		case <-ctx.Done():
+			fmt.Println("")
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		var dlqStats QueueStats
+		var err error
+		stats, dlqStats, err = getStats()
+		if err != nil {
+			fmt.Println("")
+			return err
+		}
+
+		fmt.Print("\033[G\033[K") // move the cursor left and clear the line
+		fmt.Printf("%s - %8d messages remaining (%d available, %d in-flight, %d delayed), "+
+			"%6d in dead-letter queue, ETA: %s",
+			time.Now().Format("2006-01-02 15:04:05"),
+			stats.Total(),
+			stats.Visible,
+			stats.InFlight,
+			stats.Delayed,
+			dlqStats.Total(),
+			queueETA(initial.Total(), stats.Total(), time.Since(timeStart)),
+		)
+
+		if dlqStats.Total() > initialDlq.Total() {
+			fmt.Println("")
+			return fmt.Errorf("dead-letter queue grew from %d to %d messages", initialDlq.Total(), dlqStats.Total())
+		}
+	}
+
+	fmt.Println("")
+	fmt.Printf("%s - Queue drained in %s\n",
+		time.Now().Format("2006-01-02 15:04:05"), time.Since(timeStart).Round(time.Second))
+	return nil
+}
+
+// Returns the estimated time until the queue is drained from the consumption rate
+// observed since the start.
+func queueETA(initial, remaining int64, elapsed time.Duration) string {
+	consumed := initial - remaining
+	if consumed <= 0 || elapsed <= 0 {
+		return "unknown"
+	}
+	rate := float64(consumed) / elapsed.Seconds()
+	return time.Duration(float64(remaining) / rate * float64(time.Second)).Round(time.Second).String()
+}
+
+func printQueueStats(queueURL string, stats QueueStats, dlqURL string, dlqStats QueueStats) {
+	lineSeparator := strings.Repeat("-", numberOfSeparatorChars)
+	fmt.Println(lineSeparator)
+	fmt.Printf(`Queue: %s
+    Messages available : %8d
+    Messages in-flight : %8d
+    Messages delayed   : %8d
+`,
+		queueURL,
+		stats.Visible,
+		stats.InFlight,
+		stats.Delayed,
+	)
+	if dlqURL == "" {
+		fmt.Println("Dead-letter queue: none")
+	} else {
+		fmt.Printf(`Dead-letter queue: %s
+    Messages           : %8d
+`,
+			dlqURL,
+			dlqStats.Total(),
+		)
+	}
+	fmt.Println(lineSeparator)
+}
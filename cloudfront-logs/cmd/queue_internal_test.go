@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetQueueIntervalFlag(t *testing.T) {
+	for _, tc := range []struct {
+		args  []string
+		valid bool
+	}{
+		{[]string{}, true},
+		{[]string{"--interval", "30s"}, true},
+		{[]string{"--interval", "0"}, false},
+		{[]string{"--interval", "-1s"}, false},
+	} {
+		cmd := &cobra.Command{}
+		cmd.Flags().Duration("interval", defaultQueueInterval, "")
+		require.NoError(t, cmd.ParseFlags(tc.args))
+		_, err := getQueueIntervalFlag(cmd)
+		if tc.valid {
+			assert.NoError(t, err, tc.args)
+		} else {
+			assert.Error(t, err, tc.args)
+		}
+	}
+}
+
+func TestQueueETA(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		initial   int64
+		remaining int64
+		elapsed   time.Duration
+		eta       string
+	}{
+		{"draining", 100, 50, 10 * time.Second, "10s"},
+		{"drained", 100, 0, 10 * time.Second, "0s"},
+		{"empty queue", 0, 0, 10 * time.Second, "unknown"},
+		{"no consumption", 100, 100, 10 * time.Second, "unknown"},
+		{"growing queue", 100, 150, 10 * time.Second, "unknown"},
+		{"no elapsed time", 100, 50, 0, "unknown"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.eta, queueETA(tc.initial, tc.remaining, tc.elapsed))
+		})
+	}
+}
+
+// Returns a getStats function of waitForQueue returning the stats in order, the last ones repeated
+func queueStatsSequence(stats []QueueStats, dlqStats []QueueStats) func() (QueueStats, QueueStats, error) {
+	i := 0
+	return func() (QueueStats, QueueStats, error) {
+		j := min(i, len(stats)-1)
+		i++
+		return stats[j], dlqStats[j], nil
+	}
+}
+
+func TestWaitForQueue(t *testing.T) {
+	ctx := context.Background()
+	initial := QueueStats{Visible: 10}
+	initialDlq := QueueStats{Visible: 2}
+
+	getStats := queueStatsSequence(
+		[]QueueStats{{Visible: 5, InFlight: 2}, {InFlight: 1}, {}},
+		[]QueueStats{initialDlq, initialDlq, initialDlq},
+	)
+	require.NoError(t, waitForQueue(ctx, getStats, initial, initialDlq, time.Millisecond))
+
+	// The dead-letter queue grows while waiting
+	getStats = queueStatsSequence(
+		[]QueueStats{{Visible: 5}, {Visible: 2}},
+		[]QueueStats{initialDlq, {Visible: 3}},
+	)
+	err := waitForQueue(ctx, getStats, initial, initialDlq, time.Millisecond)
+	require.ErrorContains(t, err, "dead-letter queue grew from 2 to 3 messages")
+
+	statsErr := errors.New("stats failed")
+	err = waitForQueue(ctx, func() (QueueStats, QueueStats, error) {
+		return QueueStats{}, QueueStats{}, statsErr
+	}, initial, initialDlq, time.Millisecond)
+	require.ErrorIs(t, err, statsErr)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	err = waitForQueue(cancelled, getStats, initial, initialDlq, time.Hour)
+	require.ErrorIs(t, err, context.Canceled)
+}
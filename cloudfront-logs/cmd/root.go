@@ -34,11 +34,37 @@ func Execute() {
 }
 
 func init() {
-	rootCmd.PersistentFlags().StringP("profile", "a", "", `AWS account (profile).
-	One of ['swisstopo-bgdi', 'swisstopo-bgdi-dev']`)
-	rootCmd.PersistentFlags().StringP("bucket", "b", "", "S3 Bucket")
-	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "Verbose print output")
+	addRootFlags(rootCmd)
 
 	_ = rootCmd.MarkPersistentFlagRequired("profile")
 	_ = rootCmd.MarkPersistentFlagRequired("bucket")
 }
+
+// Adds the persistent flags of the root command to the command
+func addRootFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringP("profile", "a", "", `AWS account (profile).
+	One of ['swisstopo-bgdi', 'swisstopo-bgdi-dev']`)
+	cmd.PersistentFlags().StringP("bucket", "b", "", "S3 Bucket")
+	cmd.PersistentFlags().BoolP("verbose", "v", false, "Verbose print output")
+	cmd.PersistentFlags().String("sqs-queue-url", "", `Partitioning SQS queue URL. Default is the manual
+	partitioning queue of the profile. FIFO queues (.fifo) are supported`)
+	cmd.PersistentFlags().Bool("no-profile", false, `Do not use the AWS profile for credentials but the default
+	credential chain (environment, web identity, container or instance role). The profile still selects the
+	environment.`)
+	cmd.PersistentFlags().String("role-arn", "", `Role to assume for AWS permissions. The credentials are
+	refreshed for long runs.`)
+	cmd.PersistentFlags().String("external-id", "", "External ID used to assume the --role-arn")
+	cmd.PersistentFlags().String("web-identity-token-file", "", `Web identity token file (e.g. kubernetes
+	service account token) used to assume the --role-arn`)
+}
+
+// Makes the persistent flags marked as required in rootCmd optional. To be called in the
+// PreRun of commands that don't work on a single profile/bucket, the required flags are
+// validated after the PreRun.
+func unmarkRequiredFlags(cmd *cobra.Command, names ...string) {
+	for _, name := range names {
+		if flag := cmd.Flag(name); flag != nil {
+			delete(flag.Annotations, cobra.BashCompOneRequiredFlag)
+		}
+	}
+}
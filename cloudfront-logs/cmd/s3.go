@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"context"
+	"io"
+	"os"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
@@ -41,3 +43,31 @@ func (basics *S3Basics) GetListObjectsPaginator(config partitionConfig) *s3.List
 
 	return paginator
 }
+
+// Downloads the object to the file, the file is written atomically. Returns the number of
+// bytes written.
+func (basics *S3Basics) DownloadObject(bucket, key, filename string) (int64, error) {
+	output, err := basics.Client.GetObject(basics.Context, &s3.GetObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer output.Body.Close()
+
+	tmp := filename + ".part"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, downloadFileMode)
+	if err != nil {
+		return 0, err
+	}
+	written, err := io.Copy(file, output.Body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return 0, err
+	}
+	return written, os.Rename(tmp, filename)
+}
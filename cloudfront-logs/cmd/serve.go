@@ -0,0 +1,530 @@
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const defaultServeWorkers = 2
+const defaultServeQueueSize = 10
+const defaultServeFinishedJobs = 100
+const serveJobIDBytes = 8
+
+// Maximum size of a job submission body
+const maxServeRequestBytes = 64 * 1024
+
+// Status of the partition jobs of the serve command
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+	jobCancelled = "cancelled"
+)
+
+var errQueueFull = errors.New("job queue is full")
+
+// partitionJobRequest is the body of a job submission, empty values default to the
+// serve command flags.
+type partitionJobRequest struct {
+	Bucket        string `json:"bucket"`
+	Prefix        string `json:"prefix"`
+	TimestampFrom string `json:"timestampFrom"`
+	TimestampTo   string `json:"timestampTo"`
+	Duration      string `json:"duration"`
+	DryRun        bool   `json:"dryRun"`
+}
+
+// partitionJob is a partition job submitted to the serve command
+type partitionJob struct {
+	ID          string              `json:"id"`
+	Request     partitionJobRequest `json:"request"`
+	Status      string              `json:"status"`
+	Error       string              `json:"error,omitempty"`
+	TimeFrom    time.Time           `json:"timeFrom"`
+	TimeTo      time.Time           `json:"timeTo"`
+	SubmittedAt time.Time           `json:"submittedAt"`
+	StartedAt   *time.Time          `json:"startedAt,omitempty"`
+	FinishedAt  *time.Time          `json:"finishedAt,omitempty"`
+	Metrics     metrics             `json:"metrics"`
+
+	config partitionConfig
+	cancel context.CancelFunc
+}
+
+// jobManager runs the submitted partition jobs with a pool of workers
+type jobManager struct {
+	mutex sync.Mutex
+	jobs  map[string]*partitionJob
+	order []string
+	// Queued jobs not cancelled, in submission order
+	pending   []*partitionJob
+	queueSize int
+	// Number of finished jobs kept, the oldest ones are removed
+	maxFinished int
+	// Wakes up a worker waiting for a job
+	wake  chan struct{}
+	state *StateStore
+	conf  partitionConfig
+}
+
+// serve subcommand
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve a REST API to submit partition jobs",
+	Long: `Serve a REST API to submit, poll and cancel partition jobs, so that the partitioning can
+be triggered without the CLI and AWS credentials. The jobs run with the credentials and the
+partition flags of the server, --bucket is the default bucket of the jobs. At most --queue-size
+jobs wait to run and only the last --max-finished-jobs finished jobs are kept.
+
+All endpoints except /healthz require the header "Authorization: Bearer <token>" with the token
+of the --token-file.
+
+Endpoints:
+	POST   /jobs              submit a job, body:
+	                          {"bucket": "...", "prefix": "...", "timestampFrom": "2025-04-25",
+	                           "timestampTo": "2025-04-26", "duration": "", "dryRun": true}
+	GET    /jobs              list the jobs
+	GET    /jobs/{id}         get the status of a job
+	GET    /jobs/{id}/metrics get the metrics of a job
+	DELETE /jobs/{id}         cancel a job
+	GET    /healthz           health check
+
+Examples:
+	cloudfront-logs serve --profile swisstopo-bgdi-dev --bucket swisstopo-bgdi-dev-cloudfront-logs-v2 \
+	--token-file /etc/cloudfront-logs/token --listen :8080
+
+	curl -H "Authorization: Bearer $TOKEN" -d '{"prefix": "sys-data.dev.bgdi.ch", \
+	"timestampFrom": "yesterday", "duration": "1d"}' http://localhost:8080/jobs
+`,
+	Args: cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		conf, err := newPartionConfig(cmd)
+		if err != nil {
+			return err
+		}
+		token, err := readToken(cmd.Flag("token-file").Value.String())
+		if err != nil {
+			return err
+		}
+		workers, err := cmd.Flags().GetInt("workers")
+		if err != nil {
+			return err
+		}
+		queueSize, err := cmd.Flags().GetInt("queue-size")
+		if err != nil {
+			return err
+		}
+		maxFinished, err := cmd.Flags().GetInt("max-finished-jobs")
+		if err != nil {
+			return err
+		}
+
+		var state *StateStore
+		if conf.StateFile != "" {
+			state, err = NewStateStore(conf.StateFile)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = state.Close() }()
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		if !conf.SkipPreflight {
+			err = runPreflight(ctx, conf)
+			if err != nil {
+				return err
+			}
+		}
+
+		manager := newJobManager(conf, state, queueSize, maxFinished)
+		var wg sync.WaitGroup
+		for range max(workers, 1) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				manager.work(ctx)
+			}()
+		}
+
+		server := &http.Server{
+			Addr:              cmd.Flag("listen").Value.String(),
+			Handler:           newServeMux(manager, token),
+			ReadHeaderTimeout: watchReadHeaderTimeout,
+		}
+		go func() {
+			<-ctx.Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), watchShutdownTimeout)
+			defer cancel()
+			_ = server.Shutdown(shutdownCtx)
+		}()
+
+		fmt.Printf("%s - Serving partition jobs on %s\n", time.Now().Format("2006-01-02 15:04:05"), server.Addr)
+		err = server.ListenAndServe()
+		if !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		// Running jobs are cancelled with the context
+		wg.Wait()
+		return nil
+	},
+}
+
+//-----------------------------------------------------------------------------
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	addPartitionFlags(serveCmd)
+	serveCmd.Flags().String("listen", ":8080", "Address of the HTTP server")
+	serveCmd.Flags().String("token-file", "", "File with the token required to access the API")
+	serveCmd.Flags().Int("workers", defaultServeWorkers, "Number of jobs run in parallel")
+	serveCmd.Flags().Int("queue-size", defaultServeQueueSize, "Maximum number of jobs waiting to run")
+	serveCmd.Flags().Int("max-finished-jobs", defaultServeFinishedJobs,
+		"Maximum number of finished jobs kept in the job list, the oldest ones are removed")
+
+	_ = serveCmd.MarkFlagRequired("token-file")
+}
+
+//-----------------------------------------------------------------------------
+
+func readToken(filename string) (string, error) {
+	d, err := os.ReadFile(filename)
+	if err != nil {
+		return "", fmt.Errorf("failed to read token file: %w", err)
+	}
+	token := strings.TrimSpace(string(d))
+	if token == "" {
+		return "", fmt.Errorf("empty token file %s", filename)
+	}
+	return token, nil
+}
+
+func newJobManager(conf partitionConfig, state *StateStore, queueSize int, maxFinished int) *jobManager {
+	return &jobManager{
+		jobs:        map[string]*partitionJob{},
+		queueSize:   max(queueSize, 1),
+		maxFinished: max(maxFinished, 0),
+		wake:        make(chan struct{}, 1),
+		state:       state,
+		conf:        conf,
+	}
+}
+
+// Returns the config of the job request from the server config
+func (manager *jobManager) jobConfig(request partitionJobRequest) (partitionConfig, error) {
+	conf := manager.conf
+	if request.Bucket != "" {
+		conf.S3Bucket = request.Bucket
+	}
+	conf.S3Prefix = request.Prefix
+	conf.DryRun = request.DryRun
+
+	var err error
+	conf.TimeFrom, conf.TimeTo, err = parseTimeWindow(
+		request.TimestampFrom,
+		request.TimestampTo,
+		request.Duration,
+		time.Now(),
+		conf.TimeZone,
+	)
+	return conf, err
+}
+
+// Queues a new job, fails if the request is invalid or if the queue is full
+func (manager *jobManager) submit(request partitionJobRequest) (*partitionJob, error) {
+	conf, err := manager.jobConfig(request)
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, serveJobIDBytes)
+	_, err = rand.Read(id)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &partitionJob{
+		ID:          hex.EncodeToString(id),
+		Request:     request,
+		Status:      jobQueued,
+		TimeFrom:    conf.TimeFrom,
+		TimeTo:      conf.TimeTo,
+		SubmittedAt: time.Now(),
+		config:      conf,
+	}
+
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	// The cancelled jobs are not in pending and don't count
+	if len(manager.pending) >= manager.queueSize {
+		return nil, errQueueFull
+	}
+	manager.pending = append(manager.pending, job)
+	manager.jobs[job.ID] = job
+	manager.order = append(manager.order, job.ID)
+	manager.notify()
+	return job, nil
+}
+
+// Wakes up a waiting worker, if a worker is already woken up it takes the job
+func (manager *jobManager) notify() {
+	select {
+	case manager.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Returns the next queued job, nil if none. Must be called with the mutex locked.
+func (manager *jobManager) next() *partitionJob {
+	if len(manager.pending) == 0 {
+		return nil
+	}
+	job := manager.pending[0]
+	manager.pending = manager.pending[1:]
+	if len(manager.pending) > 0 {
+		// Other workers can run the next jobs
+		manager.notify()
+	}
+	return job
+}
+
+// Removes the oldest finished jobs above maxFinished. Must be called with the mutex locked.
+func (manager *jobManager) prune() {
+	finished := 0
+	for _, id := range manager.order {
+		if manager.jobs[id].FinishedAt != nil {
+			finished++
+		}
+	}
+	manager.order = slices.DeleteFunc(manager.order, func(id string) bool {
+		if finished <= manager.maxFinished || manager.jobs[id].FinishedAt == nil {
+			return false
+		}
+		finished--
+		delete(manager.jobs, id)
+		return true
+	})
+}
+
+// Returns a copy of the job, false if not found
+func (manager *jobManager) get(id string) (partitionJob, bool) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	job, ok := manager.jobs[id]
+	if !ok {
+		return partitionJob{}, false
+	}
+	return *job, true
+}
+
+// Returns a copy of the jobs in submission order
+func (manager *jobManager) list() []partitionJob {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	jobs := make([]partitionJob, 0, len(manager.order))
+	for _, id := range manager.order {
+		jobs = append(jobs, *manager.jobs[id])
+	}
+	return jobs
+}
+
+// Cancels a queued or running job, returns false if not found
+func (manager *jobManager) cancel(id string) (partitionJob, bool) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	job, ok := manager.jobs[id]
+	if !ok {
+		return partitionJob{}, false
+	}
+	switch job.Status {
+	case jobQueued:
+		now := time.Now()
+		job.Status = jobCancelled
+		job.FinishedAt = &now
+		manager.pending = slices.DeleteFunc(manager.pending, func(j *partitionJob) bool { return j == job })
+		defer manager.prune()
+	case jobRunning:
+		// The status is set by the worker when runPartition returns
+		job.cancel()
+	}
+	return *job, true
+}
+
+// Runs the queued jobs until the context is done
+func (manager *jobManager) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		manager.mutex.Lock()
+		job := manager.next()
+		manager.mutex.Unlock()
+		if job != nil {
+			manager.run(ctx, job)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+		case <-manager.wake:
+		}
+	}
+}
+
+func (manager *jobManager) run(ctx context.Context, job *partitionJob) {
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	manager.mutex.Lock()
+	if job.Status != jobQueued {
+		// Cancelled while queued
+		manager.mutex.Unlock()
+		return
+	}
+	now := time.Now()
+	job.Status = jobRunning
+	job.StartedAt = &now
+	job.Metrics.Timestamps.Start = now
+	job.cancel = cancel
+	manager.mutex.Unlock()
+
+	// Collect the metrics live to be able to poll them
+	ch := make(chan metrics)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for metric := range ch {
+			manager.mutex.Lock()
+			job.Metrics.add(metric)
+			manager.mutex.Unlock()
+		}
+	}()
+
+	err := runPartition(jobCtx, job.config, manager.state, ch)
+
+	close(ch)
+	wg.Wait()
+
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	finished := time.Now()
+	job.FinishedAt = &finished
+	job.Metrics.Durations.Total = finished.Sub(now)
+	switch {
+	case jobCtx.Err() != nil:
+		job.Status = jobCancelled
+	case err != nil:
+		job.Status = jobFailed
+		job.Error = err.Error()
+	default:
+		job.Status = jobSucceeded
+	}
+	manager.prune()
+	fmt.Printf("%s - Job %s %s (s3://%s/%s, %s)\n",
+		finished.Format("2006-01-02 15:04:05"),
+		job.ID,
+		job.Status,
+		job.config.S3Bucket,
+		job.config.S3Prefix,
+		formatTimeWindow(job.TimeFrom, job.TimeTo),
+	)
+}
+
+//-----------------------------------------------------------------------------
+
+// Returns the handlers of the API
+func newServeMux(manager *jobManager, token string) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = fmt.Fprintln(w, "ok")
+	})
+
+	mux.Handle("POST /jobs", requireToken(token, func(w http.ResponseWriter, r *http.Request) {
+		request := partitionJobRequest{}
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxServeRequestBytes))
+		decoder.DisallowUnknownFields()
+		err := decoder.Decode(&request)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid job: %w", err))
+			return
+		}
+		job, err := manager.submit(request)
+		switch {
+		case errors.Is(err, errQueueFull):
+			writeError(w, http.StatusServiceUnavailable, err)
+		case err != nil:
+			writeError(w, http.StatusBadRequest, err)
+		default:
+			writeJSON(w, http.StatusAccepted, job)
+		}
+	}))
+
+	mux.Handle("GET /jobs", requireToken(token, func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, manager.list())
+	}))
+
+	mux.Handle("GET /jobs/{id}", requireToken(token, func(w http.ResponseWriter, r *http.Request) {
+		job, ok := manager.get(r.PathValue("id"))
+		if !ok {
+			writeError(w, http.StatusNotFound, errors.New("job not found"))
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+	}))
+
+	mux.Handle("GET /jobs/{id}/metrics", requireToken(token, func(w http.ResponseWriter, r *http.Request) {
+		job, ok := manager.get(r.PathValue("id"))
+		if !ok {
+			writeError(w, http.StatusNotFound, errors.New("job not found"))
+			return
+		}
+		writeJSON(w, http.StatusOK, job.Metrics)
+	}))
+
+	mux.Handle("DELETE /jobs/{id}", requireToken(token, func(w http.ResponseWriter, r *http.Request) {
+		job, ok := manager.cancel(r.PathValue("id"))
+		if !ok {
+			writeError(w, http.StatusNotFound, errors.New("job not found"))
+			return
+		}
+		writeJSON(w, http.StatusAccepted, job)
+	}))
+
+	return mux
+}
+
+// Returns the handler only called if the request has the bearer token
+func requireToken(token string, handler http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bearer, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found || subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+			writeError(w, http.StatusUnauthorized, errors.New("invalid or missing token"))
+			return
+		}
+		handler(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeMux(t *testing.T) {
+	// Without workers the jobs stay queued
+	manager := newJobManager(partitionConfig{S3Bucket: "default-bucket", TimeZone: time.UTC}, nil, 1, 1)
+	mux := newServeMux(manager, "secret")
+	call := func(method, path, token, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/healthz", "", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, call(http.MethodGet, "/jobs", "", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, call(http.MethodGet, "/jobs", "wrong", "").Code)
+
+	// Invalid jobs
+	assert.Equal(t, http.StatusBadRequest, call(http.MethodPost, "/jobs", "secret", `{"unknown": 1}`).Code)
+	assert.Equal(t, http.StatusBadRequest,
+		call(http.MethodPost, "/jobs", "secret", `{"timestampFrom": "2025-04-26", "timestampTo": "2025-04-25"}`).Code)
+
+	response := call(http.MethodPost, "/jobs", "secret",
+		`{"prefix": "a.ch", "timestampFrom": "2025-04-25", "duration": "1d", "dryRun": true}`)
+	require.Equal(t, http.StatusAccepted, response.Code)
+	job := partitionJob{}
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &job))
+	assert.Equal(t, jobQueued, job.Status)
+	assert.Equal(t, time.Date(2025, 4, 26, 0, 0, 0, 0, time.UTC), job.TimeTo)
+	assert.Equal(t, "default-bucket", manager.jobs[job.ID].config.S3Bucket)
+	assert.True(t, manager.jobs[job.ID].config.DryRun)
+
+	// The queue is full
+	assert.Equal(t, http.StatusServiceUnavailable, call(http.MethodPost, "/jobs", "secret", `{}`).Code)
+
+	response = call(http.MethodGet, "/jobs/"+job.ID, "secret", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/jobs/"+job.ID+"/metrics", "secret", "").Code)
+	assert.Equal(t, http.StatusNotFound, call(http.MethodGet, "/jobs/unknown", "secret", "").Code)
+
+	response = call(http.MethodDelete, "/jobs/"+job.ID, "secret", "")
+	require.Equal(t, http.StatusAccepted, response.Code)
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &job))
+	assert.Equal(t, jobCancelled, job.Status)
+
+	jobs := []partitionJob{}
+	response = call(http.MethodGet, "/jobs", "secret", "")
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &jobs))
+	assert.Len(t, jobs, 1)
+
+	// The cancelled job does not count in the queue size
+	response = call(http.MethodPost, "/jobs", "secret", `{}`)
+	require.Equal(t, http.StatusAccepted, response.Code)
+	next := partitionJob{}
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &next))
+	require.Equal(t, http.StatusAccepted, call(http.MethodDelete, "/jobs/"+next.ID, "secret", "").Code)
+
+	// Only the last finished job is kept
+	response = call(http.MethodGet, "/jobs", "secret", "")
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &jobs))
+	require.Len(t, jobs, 1)
+	assert.Equal(t, next.ID, jobs[0].ID)
+	assert.Equal(t, http.StatusNotFound, call(http.MethodGet, "/jobs/"+job.ID, "secret", "").Code)
+}
+
+func TestJobManagerNext(t *testing.T) {
+	manager := newJobManager(partitionConfig{TimeZone: time.UTC}, nil, 2, 0)
+	first, err := manager.submit(partitionJobRequest{})
+	require.NoError(t, err)
+	second, err := manager.submit(partitionJobRequest{})
+	require.NoError(t, err)
+	_, err = manager.submit(partitionJobRequest{})
+	require.ErrorIs(t, err, errQueueFull)
+
+	// The cancelled jobs are skipped and removed without retention
+	manager.cancel(first.ID)
+	assert.Same(t, second, manager.next())
+	assert.Nil(t, manager.next())
+	_, ok := manager.get(first.ID)
+	assert.False(t, ok)
+}
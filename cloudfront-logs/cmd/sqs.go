@@ -4,34 +4,71 @@ package cmd
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"net/url"
 	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
 )
 
+// S3Event is a record of a S3 event notification, see
+// https://docs.aws.amazon.com/AmazonS3/latest/userguide/notification-content-structure.html
 type S3Event struct {
-	S3 struct {
-		Bucket struct {
-			Arn  string `json:"Arn,omitempty"`
-			Name string `json:"Name,omitempty"`
-		} `json:"Bucket"`
+	EventVersion string `json:"eventVersion,omitempty"`
+	EventSource  string `json:"eventSource,omitempty"`
+	AwsRegion    string `json:"awsRegion,omitempty"`
+	EventTime    string `json:"eventTime,omitempty"`
+	EventName    string `json:"eventName,omitempty"`
+	S3           struct {
+		SchemaVersion string `json:"s3SchemaVersion,omitempty"`
+		Bucket        struct {
+			Arn  string `json:"arn,omitempty"`
+			Name string `json:"name,omitempty"`
+		} `json:"bucket"`
 		Object struct {
-			Key string `json:"Key,omitempty"`
-		} `json:"Object,omitempty"`
-	} `json:"S3,omitempty"`
+			// URL encoded key
+			Key  string `json:"key,omitempty"`
+			Size int64  `json:"size,omitempty"`
+			ETag string `json:"eTag,omitempty"`
+		} `json:"object,omitempty"`
+	} `json:"s3,omitempty"`
 }
 
 type SQSMessageBody struct {
 	Records []S3Event `json:"Records"`
 }
 
+// sqsMessage is a message body with the keys of its records
+type sqsMessage struct {
+	Body string
+	Keys []string
+	// FIFO queue message group and deduplication ids
+	GroupID         string
+	DeduplicationID string
+}
+
+type QueueStats struct {
+	Visible  int64
+	InFlight int64
+	Delayed  int64
+}
+
+// Total returns the number of messages not yet consumed
+func (stats QueueStats) Total() int64 {
+	return stats.Visible + stats.InFlight + stats.Delayed
+}
+
 type SqsBasics struct {
 	Client  *sqs.Client
 	Context context.Context
@@ -44,54 +81,50 @@ func NewSqsBasics(ctx context.Context, awsConfig aws.Config) *SqsBasics {
 	}
 }
 
-func (basics SqsBasics) PublishKeys(cfg partitionConfig, keys []string, metrics *metrics) error {
-	// Keys is a list of up to 1000 s3 keys (filenames).
-	for batchChunk := range slices.Chunk(keys, (cfg.SqsBatchSize * cfg.SqsMessageRecords)) {
-		timestamp := time.Now()
+// publishedFunc is called with the keys of each batch successfully sent to the queue
+type publishedFunc func(keys []string) error
+
+func (basics SqsBasics) PublishKeys(
+	cfg partitionConfig,
+	objects []s3types.Object,
+	metrics *metrics,
+	onPublished publishedFunc,
+) error {
+	timestamp := time.Now()
+	// Objects is a list of up to 1000 s3 objects (files).
+	messages, err := buildSqsMessages(cfg, objects)
+	if err != nil {
+		return err
+	}
+	batches := chunkSqsBatches(messages, cfg.SqsBatchSize, maxSqsBatchBytes)
+	metrics.Durations.BuildSqsPayload += time.Since(timestamp)
 
+	for _, batch := range batches {
 		// SQS Batch Message content
 		params := sqs.SendMessageBatchInput{
 			QueueUrl: &cfg.SqsQueueURL,
 		}
-
-		// Build the content of a SQS message and add it to the batch.
-		// Note: SQS max batch size = 10!
-		for messageChunk := range slices.Chunk(batchChunk, cfg.SqsMessageRecords) {
-			// Create a SQS message body and id
-			body := SQSMessageBody{}
-			id := uuid.New().String()
-
-			for _, item := range messageChunk {
-				// Create one s3 event (record) for each key and add it to the sqs message body
-				record := S3Event{}
-				record.S3.Bucket.Name = cfg.S3Bucket
-				record.S3.Bucket.Arn = fmt.Sprintf("arn:aws:s3:::%s", cfg.S3Bucket)
-				record.S3.Object.Key = item
-
-				body.Records = append(body.Records, record)
-			}
-
-			// Convert the body to a json string
-			jsonBody, err := json.Marshal(body)
-			if err != nil {
-				return err
-			}
-			jsonBodyString := string(jsonBody)
-
+		keys := []string{}
+		for _, message := range batch {
 			// Create the SQS message (batch entry) and add it to the batch
 			entry := types.SendMessageBatchRequestEntry{
-				Id:          &id,
-				MessageBody: &jsonBodyString,
+				Id:          aws.String(uuid.New().String()),
+				MessageBody: aws.String(message.Body),
+			}
+			if message.GroupID != "" {
+				entry.MessageGroupId = aws.String(message.GroupID)
+			}
+			if message.DeduplicationID != "" {
+				entry.MessageDeduplicationId = aws.String(message.DeduplicationID)
 			}
 			params.Entries = append(params.Entries, entry)
+			keys = append(keys, message.Keys...)
 		}
 
-		// Update metrics
-		metrics.Durations.BuildSqsPayload += time.Since(timestamp)
-		timestamp = time.Now()
-
 		// Send batch
-		output, err := basics.Client.SendMessageBatch(basics.Context, &params)
+		timestamp = time.Now()
+		var output *sqs.SendMessageBatchOutput
+		output, err = basics.Client.SendMessageBatch(basics.Context, &params)
 		metrics.Durations.SendSqsPayload += time.Since(timestamp)
 
 		if err != nil {
@@ -103,7 +136,353 @@ func (basics SqsBasics) PublishKeys(cfg partitionConfig, keys []string, metrics
 		if len(output.Failed) > 0 {
 			return fmt.Errorf("SQS publishing error: %+v", output.Failed)
 		}
+
+		if onPublished != nil {
+			err = onPublished(keys)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Returns the S3 event record of the object, as sent by S3 event notifications
+func newS3Event(cfg partitionConfig, obj s3types.Object) S3Event {
+	record := S3Event{
+		EventVersion: "2.1",
+		EventSource:  "aws:s3",
+		AwsRegion:    cfg.AwsRegion,
+		EventName:    "ObjectCreated:Put",
+	}
+	if obj.LastModified != nil {
+		record.EventTime = obj.LastModified.UTC().Format("2006-01-02T15:04:05.000Z")
+	}
+	record.S3.SchemaVersion = "1.0"
+	record.S3.Bucket.Name = cfg.S3Bucket
+	record.S3.Bucket.Arn = fmt.Sprintf("arn:aws:s3:::%s", cfg.S3Bucket)
+	record.S3.Object.Key = encodeS3Key(aws.ToString(obj.Key))
+	record.S3.Object.Size = aws.ToInt64(obj.Size)
+	record.S3.Object.ETag = strings.Trim(aws.ToString(obj.ETag), `"`)
+	return record
+}
+
+// Builds the SQS messages with up to cfg.SqsMessageRecords records each, without
+// exceeding the maximum SQS message size. For FIFO queues the records of a message
+// belong to the same message group and the messages have a deduplication id.
+func buildSqsMessages(cfg partitionConfig, objects []s3types.Object) ([]sqsMessage, error) {
+	if !cfg.SqsFifo {
+		return buildGroupSqsMessages(cfg, objects)
+	}
+
+	// Group the objects, keeping the order of the groups
+	groups := map[string][]s3types.Object{}
+	groupIDs := []string{}
+	for _, obj := range objects {
+		groupID := sqsGroupID(cfg, aws.ToString(obj.Key))
+		if _, ok := groups[groupID]; !ok {
+			groupIDs = append(groupIDs, groupID)
+		}
+		groups[groupID] = append(groups[groupID], obj)
+	}
+
+	messages := []sqsMessage{}
+	for _, groupID := range groupIDs {
+		groupMessages, err := buildGroupSqsMessages(cfg, groups[groupID])
+		if err != nil {
+			return nil, err
+		}
+		for i := range groupMessages {
+			groupMessages[i].GroupID = groupID
+			groupMessages[i].DeduplicationID = sqsDeduplicationID(cfg, groupMessages[i])
+		}
+		messages = append(messages, groupMessages...)
+	}
+	return messages, nil
+}
+
+// Returns the FIFO message group id of the key according to cfg.SqsGroupBy
+func sqsGroupID(cfg partitionConfig, key string) string {
+	const maxGroupIDLength = 128
+	groupID := cfg.S3Bucket
+	if matches := keyRe.FindStringSubmatch(key); matches != nil {
+		switch cfg.SqsGroupBy {
+		case sqsGroupByHour:
+			groupID = matches[2]
+		case sqsGroupByPrefixHour:
+			groupID = matches[1] + "/" + matches[2]
+		case sqsGroupByBucket:
+		default: // sqsGroupByPrefix
+			groupID = matches[1]
+		}
 	}
+	if len(groupID) > maxGroupIDLength {
+		hash := sha256.Sum256([]byte(groupID))
+		groupID = hex.EncodeToString(hash[:])
+	}
+	return groupID
+}
+
+// Returns the FIFO message deduplication id according to cfg.SqsDeduplication, empty if
+// the queue uses content based deduplication
+func sqsDeduplicationID(cfg partitionConfig, message sqsMessage) string {
+	var hash [sha256.Size]byte
+	switch cfg.SqsDeduplication {
+	case sqsDeduplicationContent:
+		if cfg.SqsContentDedup {
+			return ""
+		}
+		hash = sha256.Sum256([]byte(message.Body))
+	default: // sqsDeduplicationKeyHash
+		hash = sha256.Sum256([]byte(cfg.S3Bucket + "\n" + strings.Join(message.Keys, "\n")))
+	}
+	return hex.EncodeToString(hash[:])
+}
+
+// Builds the SQS messages of objects belonging to the same message group
+func buildGroupSqsMessages(cfg partitionConfig, objects []s3types.Object) ([]sqsMessage, error) {
+	const prefix = `{"Records":[`
+	const suffix = `]}`
+
+	messages := []sqsMessage{}
+	records := []string{}
+	keys := []string{}
+	size := len(prefix) + len(suffix)
 
+	flush := func() {
+		if len(records) > 0 {
+			messages = append(messages, sqsMessage{
+				Body: prefix + strings.Join(records, ",") + suffix,
+				Keys: keys,
+			})
+		}
+		records = []string{}
+		keys = []string{}
+		size = len(prefix) + len(suffix)
+	}
+
+	for _, obj := range objects {
+		record, err := json.Marshal(newS3Event(cfg, obj))
+		if err != nil {
+			return nil, err
+		}
+		if len(prefix)+len(record)+len(suffix) > maxSqsMessageBytes {
+			return nil, fmt.Errorf("s3 key %s too big for a SQS message", aws.ToString(obj.Key))
+		}
+		// +1 for the records separator
+		if len(records) >= cfg.SqsMessageRecords || size+len(record)+1 > maxSqsMessageBytes {
+			flush()
+		}
+		records = append(records, string(record))
+		keys = append(keys, aws.ToString(obj.Key))
+		size += len(record) + 1
+	}
+	flush()
+
+	return messages, nil
+}
+
+// Groups the messages in batches of up to batchSize messages without exceeding the
+// maximum batch payload size.
+func chunkSqsBatches(messages []sqsMessage, batchSize int, maxBytes int) [][]sqsMessage {
+	batches := [][]sqsMessage{}
+	batch := []sqsMessage{}
+	size := 0
+	for _, message := range messages {
+		if len(batch) > 0 && (len(batch) >= batchSize || size+len(message.Body) > maxBytes) {
+			batches = append(batches, batch)
+			batch = []sqsMessage{}
+			size = 0
+		}
+		batch = append(batch, message)
+		size += len(message.Body)
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+// Returns the key URL encoded as in S3 event notifications
+func encodeS3Key(key string) string {
+	return strings.ReplaceAll(url.QueryEscape(key), "%2F", "/")
+}
+
+// Returns the key of a S3 event notification decoded
+func decodeS3Key(key string) string {
+	decoded, err := url.QueryUnescape(key)
+	if err != nil {
+		return key
+	}
+	return decoded
+}
+
+// SetQueueType detects if the queue of the config is a FIFO queue, from its URL, and
+// if the FIFO queue has content based deduplication enabled
+func (basics SqsBasics) SetQueueType(cfg *partitionConfig) error {
+	cfg.SqsFifo = strings.HasSuffix(cfg.SqsQueueURL, ".fifo")
+	if !cfg.SqsFifo {
+		return nil
+	}
+
+	output, err := basics.Client.GetQueueAttributes(basics.Context, &sqs.GetQueueAttributesInput{
+		QueueUrl:       &cfg.SqsQueueURL,
+		AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameContentBasedDeduplication},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get attributes of queue %s: %w", cfg.SqsQueueURL, err)
+	}
+	cfg.SqsContentDedup = output.Attributes[string(types.QueueAttributeNameContentBasedDeduplication)] == "true"
+
+	return nil
+}
+
+// GetQueueStats returns the approximate number of messages of the queue
+func (basics SqsBasics) GetQueueStats(queueURL string) (QueueStats, error) {
+	stats := QueueStats{}
+	output, err := basics.Client.GetQueueAttributes(basics.Context, &sqs.GetQueueAttributesInput{
+		QueueUrl: &queueURL,
+		AttributeNames: []types.QueueAttributeName{
+			types.QueueAttributeNameApproximateNumberOfMessages,
+			types.QueueAttributeNameApproximateNumberOfMessagesNotVisible,
+			types.QueueAttributeNameApproximateNumberOfMessagesDelayed,
+		},
+	})
+	if err != nil {
+		return stats, fmt.Errorf("failed to get attributes of queue %s: %w", queueURL, err)
+	}
+
+	attributes := []struct {
+		name  types.QueueAttributeName
+		value *int64
+	}{
+		{types.QueueAttributeNameApproximateNumberOfMessages, &stats.Visible},
+		{types.QueueAttributeNameApproximateNumberOfMessagesNotVisible, &stats.InFlight},
+		{types.QueueAttributeNameApproximateNumberOfMessagesDelayed, &stats.Delayed},
+	}
+	for _, attribute := range attributes {
+		*attribute.value, err = strconv.ParseInt(output.Attributes[string(attribute.name)], 10, 64)
+		if err != nil {
+			return stats, fmt.Errorf("invalid queue attribute %s: %w", attribute.name, err)
+		}
+	}
+
+	return stats, nil
+}
+
+// GetDeadLetterQueueURL returns the URL of the dead-letter queue of the queue from its
+// redrive policy, or an empty string if the queue has no dead-letter queue.
+func (basics SqsBasics) GetDeadLetterQueueURL(queueURL string) (string, error) {
+	output, err := basics.Client.GetQueueAttributes(basics.Context, &sqs.GetQueueAttributesInput{
+		QueueUrl:       &queueURL,
+		AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameRedrivePolicy},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get redrive policy of queue %s: %w", queueURL, err)
+	}
+
+	policy, ok := output.Attributes[string(types.QueueAttributeNameRedrivePolicy)]
+	if !ok {
+		return "", nil
+	}
+	redrivePolicy := struct {
+		DeadLetterTargetArn string `json:"deadLetterTargetArn"`
+	}{}
+	err = json.Unmarshal([]byte(policy), &redrivePolicy)
+	if err != nil {
+		return "", fmt.Errorf("invalid redrive policy of queue %s: %w", queueURL, err)
+	}
+
+	// arn:aws:sqs:<region>:<account>:<name>
+	const arnParts = 6
+	arn := strings.Split(redrivePolicy.DeadLetterTargetArn, ":")
+	if len(arn) != arnParts {
+		return "", fmt.Errorf("invalid dead-letter queue arn %s", redrivePolicy.DeadLetterTargetArn)
+	}
+	dlq, err := basics.Client.GetQueueUrl(basics.Context, &sqs.GetQueueUrlInput{
+		QueueName:              &arn[5],
+		QueueOwnerAWSAccountId: &arn[4],
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get dead-letter queue url %s: %w", redrivePolicy.DeadLetterTargetArn, err)
+	}
+
+	return *dlq.QueueUrl, nil
+}
+
+// ReceiveAll receives all the messages currently available in the queue (up to limit
+// messages if limit > 0). The received messages are invisible for the given visibility
+// timeout and must be deleted or released.
+func (basics SqsBasics) ReceiveAll(queueURL string, visibilityTimeout int32, limit int) ([]types.Message, error) {
+	const maxMessages = 10
+	const waitTimeSeconds = 1
+	messages := []types.Message{}
+	for limit <= 0 || len(messages) < limit {
+		output, err := basics.Client.ReceiveMessage(basics.Context, &sqs.ReceiveMessageInput{
+			QueueUrl:            &queueURL,
+			MaxNumberOfMessages: maxMessages,
+			VisibilityTimeout:   visibilityTimeout,
+			WaitTimeSeconds:     waitTimeSeconds,
+		})
+		if err != nil {
+			return messages, fmt.Errorf("failed to receive messages from %s: %w", queueURL, err)
+		}
+		if len(output.Messages) == 0 {
+			break
+		}
+		messages = append(messages, output.Messages...)
+	}
+	if limit > 0 && len(messages) > limit {
+		// Release the messages above the limit
+		err := basics.ReleaseMessages(queueURL, messages[limit:])
+		if err != nil {
+			return messages, err
+		}
+		messages = messages[:limit]
+	}
+	return messages, nil
+}
+
+// DeleteMessages deletes the received messages from the queue
+func (basics SqsBasics) DeleteMessages(queueURL string, messages []types.Message) error {
+	for chunk := range slices.Chunk(messages, maxSqsBatchSize) {
+		params := sqs.DeleteMessageBatchInput{QueueUrl: &queueURL}
+		for i, message := range chunk {
+			params.Entries = append(params.Entries, types.DeleteMessageBatchRequestEntry{
+				Id:            aws.String(strconv.Itoa(i)),
+				ReceiptHandle: message.ReceiptHandle,
+			})
+		}
+		output, err := basics.Client.DeleteMessageBatch(basics.Context, &params)
+		if err != nil {
+			return fmt.Errorf("failed to delete messages from %s: %w", queueURL, err)
+		}
+		if len(output.Failed) > 0 {
+			return fmt.Errorf("SQS delete error: %+v", output.Failed)
+		}
+	}
+	return nil
+}
+
+// ReleaseMessages makes the received messages visible again in the queue
+func (basics SqsBasics) ReleaseMessages(queueURL string, messages []types.Message) error {
+	for chunk := range slices.Chunk(messages, maxSqsBatchSize) {
+		params := sqs.ChangeMessageVisibilityBatchInput{QueueUrl: &queueURL}
+		for i, message := range chunk {
+			params.Entries = append(params.Entries, types.ChangeMessageVisibilityBatchRequestEntry{
+				Id:                aws.String(strconv.Itoa(i)),
+				ReceiptHandle:     message.ReceiptHandle,
+				VisibilityTimeout: 0,
+			})
+		}
+		output, err := basics.Client.ChangeMessageVisibilityBatch(basics.Context, &params)
+		if err != nil {
+			return fmt.Errorf("failed to release messages of %s: %w", queueURL, err)
+		}
+		if len(output.Failed) > 0 {
+			return fmt.Errorf("SQS release error: %+v", output.Failed)
+		}
+	}
 	return nil
 }
@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildSqsMessages(t *testing.T) {
+	modified := time.Date(2025, 4, 24, 14, 5, 6, 0, time.UTC)
+	conf := partitionConfig{AwsRegion: "eu-central-1", S3Bucket: "bucket", SqsMessageRecords: 2}
+	objects := []s3types.Object{}
+	for i := range 5 {
+		objects = append(objects, s3types.Object{
+			Key:          aws.String(fmt.Sprintf("a.ch/E1.2025-04-24-14.%d x.gz", i)),
+			Size:         aws.Int64(int64(100 + i)),
+			ETag:         aws.String(fmt.Sprintf(`"etag-%d"`, i)),
+			LastModified: &modified,
+		})
+	}
+
+	messages, err := buildSqsMessages(conf, objects)
+	require.NoError(t, err)
+	require.Len(t, messages, 3)
+	assert.Equal(t, []string{"a.ch/E1.2025-04-24-14.0 x.gz", "a.ch/E1.2025-04-24-14.1 x.gz"}, messages[0].Keys)
+	assert.Len(t, messages[2].Keys, 1)
+
+	body := SQSMessageBody{}
+	require.NoError(t, json.Unmarshal([]byte(messages[0].Body), &body))
+	require.Len(t, body.Records, 2)
+	record := body.Records[1]
+	assert.Equal(t, "ObjectCreated:Put", record.EventName)
+	assert.Equal(t, "2025-04-24T14:05:06.000Z", record.EventTime)
+	assert.Equal(t, "bucket", record.S3.Bucket.Name)
+	assert.Equal(t, "arn:aws:s3:::bucket", record.S3.Bucket.Arn)
+	assert.Equal(t, "a.ch/E1.2025-04-24-14.1+x.gz", record.S3.Object.Key)
+	assert.Equal(t, int64(101), record.S3.Object.Size)
+	assert.Equal(t, "etag-1", record.S3.Object.ETag)
+	assert.Equal(t, *objects[1].Key, *recordObject(record).Key)
+}
+
+func TestBuildSqsMessagesSizeLimit(t *testing.T) {
+	conf := partitionConfig{S3Bucket: "bucket", SqsMessageRecords: maxSqsMessageRecords}
+	// 100 records of ~5KiB don't fit in one message
+	objects := []s3types.Object{}
+	for i := range maxSqsMessageRecords {
+		objects = append(objects, s3types.Object{Key: aws.String(fmt.Sprintf("%d/%s", i, strings.Repeat("k", 5*1024)))})
+	}
+
+	messages, err := buildSqsMessages(conf, objects)
+	require.NoError(t, err)
+	assert.Greater(t, len(messages), 1)
+	total := 0
+	for _, message := range messages {
+		assert.LessOrEqual(t, len(message.Body), maxSqsMessageBytes)
+		total += len(message.Keys)
+	}
+	assert.Equal(t, maxSqsMessageRecords, total)
+
+	batches := chunkSqsBatches(messages, maxSqsBatchSize, maxSqsBatchBytes)
+	assert.Len(t, batches, len(messages))
+
+	// Key too big for a message
+	objects = []s3types.Object{{Key: aws.String(strings.Repeat("k", maxSqsMessageBytes))}}
+	_, err = buildSqsMessages(conf, objects)
+	require.Error(t, err)
+}
+
+func TestChunkSqsBatches(t *testing.T) {
+	messages := []sqsMessage{}
+	for range 25 {
+		messages = append(messages, sqsMessage{Body: strings.Repeat("b", 10)})
+	}
+
+	batches := chunkSqsBatches(messages, 10, 1000)
+	require.Len(t, batches, 3)
+	assert.Len(t, batches[0], 10)
+	assert.Len(t, batches[2], 5)
+
+	batches = chunkSqsBatches(messages, 10, 35)
+	require.Len(t, batches, 9)
+	assert.Len(t, batches[0], 3)
+}
+
+func TestBuildSqsMessagesFifo(t *testing.T) {
+	conf := partitionConfig{
+		S3Bucket:          "bucket",
+		SqsMessageRecords: 10,
+		SqsFifo:           true,
+		SqsGroupBy:        sqsGroupByPrefix,
+		SqsDeduplication:  sqsDeduplicationKeyHash,
+	}
+	objects := []s3types.Object{
+		{Key: aws.String("a.ch/E1.2025-04-24-14.0.gz")},
+		{Key: aws.String("b.ch/E1.2025-04-24-14.1.gz")},
+		{Key: aws.String("a.ch/E1.2025-04-24-15.2.gz")},
+	}
+
+	messages, err := buildSqsMessages(conf, objects)
+	require.NoError(t, err)
+	require.Len(t, messages, 2)
+	assert.Equal(t, "a.ch", messages[0].GroupID)
+	assert.Equal(t, []string{"a.ch/E1.2025-04-24-14.0.gz", "a.ch/E1.2025-04-24-15.2.gz"}, messages[0].Keys)
+	assert.Equal(t, "b.ch", messages[1].GroupID)
+	assert.Len(t, messages[0].DeduplicationID, 64)
+	assert.NotEqual(t, messages[0].DeduplicationID, messages[1].DeduplicationID)
+
+	// Same keys, same deduplication id
+	again, err := buildSqsMessages(conf, objects)
+	require.NoError(t, err)
+	assert.Equal(t, messages[0].DeduplicationID, again[0].DeduplicationID)
+
+	conf.SqsGroupBy = sqsGroupByHour
+	messages, err = buildSqsMessages(conf, objects)
+	require.NoError(t, err)
+	require.Len(t, messages, 2)
+	assert.Equal(t, "2025-04-24-14", messages[0].GroupID)
+	assert.Len(t, messages[0].Keys, 2)
+
+	// Queue content based deduplication
+	conf.SqsDeduplication = sqsDeduplicationContent
+	conf.SqsContentDedup = true
+	messages, err = buildSqsMessages(conf, objects)
+	require.NoError(t, err)
+	assert.Empty(t, messages[0].DeduplicationID)
+
+	// Standard queue
+	messages, err = buildSqsMessages(partitionConfig{S3Bucket: "bucket", SqsMessageRecords: 10}, objects)
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	assert.Empty(t, messages[0].GroupID)
+	assert.Empty(t, messages[0].DeduplicationID)
+}
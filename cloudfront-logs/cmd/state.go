@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// state subcommand
+var stateCmd = &cobra.Command{
+	Use:   "state",
+	Short: "Inspect or prune the local partitioning state file",
+	Long: `Inspect or prune the local state file used by the partition command (--state-file)
+to skip the files already partitioned.
+
+Examples:
+	cloudfront-logs state list --bucket swisstopo-bgdi-dev-cloudfront-logs-v2 \
+	--state-file ~/.cloudfront-logs.db --prefix sys-data.dev.bgdi.ch
+
+	cloudfront-logs state prune --bucket swisstopo-bgdi-dev-cloudfront-logs-v2 \
+	--state-file ~/.cloudfront-logs.db --older-than 720h
+`,
+	Args: cobra.ExactArgs(0),
+	PersistentPreRun: func(cmd *cobra.Command, _ []string) {
+		// The state file is local, no aws access is needed
+		unmarkRequiredFlags(cmd, "profile")
+	},
+	Run: func(cmd *cobra.Command, _ []string) {
+		_ = cmd.Help()
+	},
+}
+
+var stateListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the files already partitioned",
+	Args:  cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		state, err := NewStateStore(cmd.Flag("state-file").Value.String())
+		if err != nil {
+			return err
+		}
+		defer func() { _ = state.Close() }()
+
+		count := 0
+		err = state.Walk(
+			cmd.Flag("bucket").Value.String(),
+			cmd.Flag("prefix").Value.String(),
+			func(key string, record stateRecord) error {
+				fmt.Printf("%s  %s  %s\n", record.ProcessedAt.Format(time.RFC3339), record.ETag, key)
+				count++
+				return nil
+			},
+		)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d files\n", count)
+		return nil
+	},
+}
+
+var statePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove files from the state so that they are partitioned again",
+	Args:  cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		olderThan, err := cmd.Flags().GetDuration("older-than")
+		if err != nil {
+			return err
+		}
+		var before time.Time
+		if olderThan > 0 {
+			before = time.Now().Add(-olderThan)
+		}
+
+		state, err := NewStateStore(cmd.Flag("state-file").Value.String())
+		if err != nil {
+			return err
+		}
+		defer func() { _ = state.Close() }()
+
+		removed, err := state.Prune(cmd.Flag("bucket").Value.String(), cmd.Flag("prefix").Value.String(), before)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d files removed from state\n", removed)
+		return nil
+	},
+}
+
+//-----------------------------------------------------------------------------
+
+func init() {
+	rootCmd.AddCommand(stateCmd)
+	stateCmd.AddCommand(stateListCmd)
+	stateCmd.AddCommand(statePruneCmd)
+
+	stateCmd.PersistentFlags().String("state-file", "", "Local state file (see partition --state-file)")
+	stateCmd.PersistentFlags().StringP("prefix", "p", "", "Only files with this prefix")
+	statePruneCmd.Flags().Duration("older-than", 0, `Only files partitioned before this duration ago.
+	Examples: 720h, 48h30m. Default removes all files`)
+
+	_ = stateCmd.MarkPersistentFlagRequired("state-file")
+}
@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const stateFileMode = 0o600
+const stateOpenTimeout = 5 * time.Second
+
+// stateRecord is the value stored for each partitioned s3 key
+type stateRecord struct {
+	ETag        string    `json:"ETag"`
+	ProcessedAt time.Time `json:"ProcessedAt"`
+}
+
+// StateStore is a local embedded database (BoltDB) keeping track of the s3 keys
+// already sent for partitioning. Keys are stored per s3 bucket together with their
+// ETag, so that a modified object is partitioned again.
+type StateStore struct {
+	db *bolt.DB
+}
+
+func NewStateStore(path string) (*StateStore, error) {
+	db, err := bolt.Open(path, stateFileMode, &bolt.Options{Timeout: stateOpenTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state file %s: %w", path, err)
+	}
+	return &StateStore{db: db}, nil
+}
+
+func (store *StateStore) Close() error {
+	return store.db.Close()
+}
+
+// IsPartitioned returns true if the key has already been partitioned with the same ETag
+func (store *StateStore) IsPartitioned(bucket, key, etag string) (bool, error) {
+	found := false
+	err := store.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		value := b.Get([]byte(key))
+		if value == nil {
+			return nil
+		}
+		record := stateRecord{}
+		if err := json.Unmarshal(value, &record); err != nil {
+			return fmt.Errorf("invalid state record for key %s: %w", key, err)
+		}
+		found = record.ETag == etag
+		return nil
+	})
+	return found, err
+}
+
+// MarkPartitioned records the keys (with their ETag) as partitioned
+func (store *StateStore) MarkPartitioned(bucket string, keys []string, etags map[string]string) error {
+	now := time.Now().UTC()
+	return store.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			value, e := json.Marshal(stateRecord{ETag: etags[key], ProcessedAt: now})
+			if e != nil {
+				return e
+			}
+			e = b.Put([]byte(key), value)
+			if e != nil {
+				return e
+			}
+		}
+		return nil
+	})
+}
+
+// Walk calls fn for each record of the bucket whose key starts with prefix
+func (store *StateStore) Walk(bucket, prefix string, fn func(key string, record stateRecord) error) error {
+	return store.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		for k, v := c.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, v = c.Next() {
+			record := stateRecord{}
+			if err := json.Unmarshal(v, &record); err != nil {
+				return fmt.Errorf("invalid state record for key %s: %w", k, err)
+			}
+			if err := fn(string(k), record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Prune removes the records of the bucket whose key starts with prefix and that have
+// been processed before the given time (a zero time removes all matching records).
+// It returns the number of records removed.
+func (store *StateStore) Prune(bucket, prefix string, before time.Time) (int, error) {
+	removed := 0
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		// Collect the keys first, deleting while iterating with a cursor skips items
+		toDelete := [][]byte{}
+		c := b.Cursor()
+		for k, v := c.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, v = c.Next() {
+			record := stateRecord{}
+			if err := json.Unmarshal(v, &record); err != nil {
+				return fmt.Errorf("invalid state record for key %s: %w", k, err)
+			}
+			if before.IsZero() || record.ProcessedAt.Before(before) {
+				toDelete = append(toDelete, bytes.Clone(k))
+			}
+		}
+		for _, k := range toDelete {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		removed = len(toDelete)
+		return nil
+	})
+	return removed, err
+}
+
+// Bolt bucket of the watch cursors, not a valid s3 bucket name
+const cursorsBucket = "_cursors"
+
+// Cursor returns the time saved under the name, zero if none
+func (store *StateStore) Cursor(name string) (time.Time, error) {
+	var cursor time.Time
+	err := store.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(cursorsBucket))
+		if b == nil {
+			return nil
+		}
+		value := b.Get([]byte(name))
+		if value == nil {
+			return nil
+		}
+		if err := cursor.UnmarshalText(value); err != nil {
+			return fmt.Errorf("invalid cursor %s: %w", name, err)
+		}
+		return nil
+	})
+	return cursor, err
+}
+
+// SetCursor saves the time under the name
+func (store *StateStore) SetCursor(name string, cursor time.Time) error {
+	value, err := cursor.UTC().MarshalText()
+	if err != nil {
+		return err
+	}
+	return store.db.Update(func(tx *bolt.Tx) error {
+		b, e := tx.CreateBucketIfNotExists([]byte(cursorsBucket))
+		if e != nil {
+			return e
+		}
+		return b.Put([]byte(name), value)
+	})
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateStore(t *testing.T) {
+	state, err := NewStateStore(filepath.Join(t.TempDir(), "state.db"))
+	require.NoError(t, err)
+	defer func() { _ = state.Close() }()
+
+	keys := []string{"prefix/E1.2025-04-24-14.abc.gz", "prefix/E1.2025-04-24-15.def.gz"}
+	etags := map[string]string{keys[0]: `"etag-0"`, keys[1]: `"etag-1"`}
+
+	partitioned, err := state.IsPartitioned("bucket", keys[0], etags[keys[0]])
+	require.NoError(t, err)
+	assert.False(t, partitioned)
+
+	require.NoError(t, state.MarkPartitioned("bucket", keys, etags))
+
+	partitioned, err = state.IsPartitioned("bucket", keys[0], etags[keys[0]])
+	require.NoError(t, err)
+	assert.True(t, partitioned)
+
+	// Modified object (new ETag) and other bucket are not partitioned
+	partitioned, err = state.IsPartitioned("bucket", keys[0], `"etag-new"`)
+	require.NoError(t, err)
+	assert.False(t, partitioned)
+	partitioned, err = state.IsPartitioned("other-bucket", keys[0], etags[keys[0]])
+	require.NoError(t, err)
+	assert.False(t, partitioned)
+
+	// Nothing processed before one hour ago
+	removed, err := state.Prune("bucket", "", time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 0, removed)
+
+	removed, err = state.Prune("bucket", "prefix/", time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, removed)
+
+	count := 0
+	require.NoError(t, state.Walk("bucket", "", func(_ string, _ stateRecord) error {
+		count++
+		return nil
+	}))
+	assert.Equal(t, 0, count)
+}
+
+func TestStateStoreCursor(t *testing.T) {
+	state, err := NewStateStore(filepath.Join(t.TempDir(), "state.db"))
+	require.NoError(t, err)
+	defer func() { _ = state.Close() }()
+
+	cursor, err := state.Cursor("bucket/prefix")
+	require.NoError(t, err)
+	assert.True(t, cursor.IsZero())
+
+	expected := time.Date(2025, 4, 24, 14, 0, 0, 0, time.UTC)
+	require.NoError(t, state.SetCursor("bucket/prefix", expected))
+
+	cursor, err = state.Cursor("bucket/prefix")
+	require.NoError(t, err)
+	assert.True(t, expected.Equal(cursor))
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const hoursPerDay = 24
+const daysPerWeek = 7
+
+var (
+	isoWeekRe     = regexp.MustCompile(`^(\d\d\d\d)-W(\d\d)$`)
+	dayDurationRe = regexp.MustCompile(`^(\d+)([dw])$`)
+)
+
+// parseTimeExpression parses a time given on the command line (see parseTimeInstant) and
+// returns the start of its UTC hour, as cloudfront log keys are per UTC hour. E.g.
+// 2025-05-01T12:30:00Z and 2025-05-01-18 in Asia/Kolkata (+05:30) both return 12:00 UTC.
+func parseTimeExpression(expr string, now time.Time, loc *time.Location) (time.Time, error) {
+	ts, err := parseTimeInstant(expr, now, loc)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return ts.UTC().Truncate(time.Hour), nil
+}
+
+// parseTimeInstant parses a time given on the command line and returns it in UTC.
+//
+// The following expressions are supported:
+//   - yyyy[-mm[-dd[-hh]]] in the given location, e.g. 2025-04-23-01, 2025-03-10, 2025-02, 2024
+//   - RFC3339 timestamps, e.g. 2025-04-23T01:00:00+02:00
+//   - ISO weeks (start of the week), e.g. 2025-W17
+//   - now, today, yesterday, this-week, last-week
+//   - durations relative to now, e.g. -6h, -2d, -1w, -1h30m
+//
+// Relative expressions are truncated to the hour as cloudfront log keys are per hour.
+func parseTimeInstant(expr string, now time.Time, loc *time.Location) (time.Time, error) {
+	expr = strings.TrimSpace(expr)
+	now = now.In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	thisWeek := today.AddDate(0, 0, -((int(today.Weekday()) + daysPerWeek - 1) % daysPerWeek))
+
+	switch expr {
+	case "now":
+		return now.Truncate(time.Hour).UTC(), nil
+	case "today":
+		return today.UTC(), nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1).UTC(), nil
+	case "this-week":
+		return thisWeek.UTC(), nil
+	case "last-week":
+		return thisWeek.AddDate(0, 0, -daysPerWeek).UTC(), nil
+	}
+
+	if strings.HasPrefix(expr, "-") || strings.HasPrefix(expr, "+") {
+		d, err := parseDuration(expr[1:])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid relative time %s: %w", expr, err)
+		}
+		if expr[0] == '-' {
+			d = -d
+		}
+		return now.Add(d).Truncate(time.Hour).UTC(), nil
+	}
+
+	if matches := isoWeekRe.FindStringSubmatch(expr); matches != nil {
+		return parseISOWeek(matches[1], matches[2], loc)
+	}
+
+	if ts, err := time.Parse(time.RFC3339, expr); err == nil {
+		return ts.UTC(), nil
+	}
+
+	layouts := []string{
+		"2006-01-02-15",
+		"2006-01-02",
+		"2006-01",
+		"2006",
+	}
+	for _, layout := range layouts {
+		ts, err := time.ParseInLocation(layout, expr, loc)
+		if err == nil {
+			return ts.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %s. See --help for supported formats", expr)
+}
+
+// parseDuration parses a go duration (e.g. 1h30m) or a number of days or weeks (e.g. 2d, 1w)
+func parseDuration(s string) (time.Duration, error) {
+	if matches := dayDurationRe.FindStringSubmatch(s); matches != nil {
+		n, err := strconv.Atoi(matches[1])
+		if err != nil {
+			return 0, err
+		}
+		days := n
+		if matches[2] == "w" {
+			days = n * daysPerWeek
+		}
+		return time.Duration(days*hoursPerDay) * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// parseISOWeek returns the start (monday 00:00) of the ISO week in UTC
+func parseISOWeek(yearString, weekString string, loc *time.Location) (time.Time, error) {
+	const maxISOWeek = 53
+	year, err := strconv.Atoi(yearString)
+	if err != nil {
+		return time.Time{}, err
+	}
+	week, err := strconv.Atoi(weekString)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if week < 1 || week > maxISOWeek {
+		return time.Time{}, fmt.Errorf("invalid ISO week %s-W%s", yearString, weekString)
+	}
+	// The 4th of january is always in the first ISO week
+	jan4 := time.Date(year, time.January, 4, 0, 0, 0, 0, loc)
+	firstMonday := jan4.AddDate(0, 0, -((int(jan4.Weekday()) + daysPerWeek - 1) % daysPerWeek))
+	start := firstMonday.AddDate(0, 0, (week-1)*daysPerWeek)
+	if _, w := start.ISOWeek(); w != week {
+		return time.Time{}, fmt.Errorf("invalid ISO week %s-W%s", yearString, weekString)
+	}
+	return start.UTC(), nil
+}
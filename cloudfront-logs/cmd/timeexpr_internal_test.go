@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type timeExpressionTest struct {
+	input    string
+	timezone string
+	expected string
+}
+
+var timeExpressionTests = []timeExpressionTest{
+	{input: "2025-04-24-14", timezone: "UTC", expected: "2025-04-24T14:00:00Z"},
+	{input: "2025-04-24-14", timezone: "Europe/Zurich", expected: "2025-04-24T12:00:00Z"},
+	{input: "2025-01", timezone: "Europe/Zurich", expected: "2024-12-31T23:00:00Z"},
+	{input: "2025-04-24T14:30:00+02:00", timezone: "UTC", expected: "2025-04-24T12:00:00Z"},
+	{input: "2025-05-01T12:30:00Z", timezone: "UTC", expected: "2025-05-01T12:00:00Z"},
+	{input: "2025-05-01T18:00:00+05:30", timezone: "UTC", expected: "2025-05-01T12:00:00Z"},
+	{input: "2025-05-01-18", timezone: "Asia/Kolkata", expected: "2025-05-01T12:00:00Z"},
+	{input: "2025-05-01", timezone: "Asia/Kolkata", expected: "2025-04-30T18:00:00Z"},
+	{input: "2025-W17", timezone: "UTC", expected: "2025-04-21T00:00:00Z"},
+	{input: "2026-W01", timezone: "UTC", expected: "2025-12-29T00:00:00Z"},
+	{input: "now", timezone: "UTC", expected: "2025-04-24T14:00:00Z"},
+	{input: "-6h", timezone: "UTC", expected: "2025-04-24T08:00:00Z"},
+	{input: "-2d", timezone: "UTC", expected: "2025-04-22T14:00:00Z"},
+	{input: "today", timezone: "Europe/Zurich", expected: "2025-04-23T22:00:00Z"},
+	{input: "yesterday", timezone: "UTC", expected: "2025-04-23T00:00:00Z"},
+	{input: "this-week", timezone: "UTC", expected: "2025-04-21T00:00:00Z"},
+	{input: "last-week", timezone: "UTC", expected: "2025-04-14T00:00:00Z"},
+}
+
+func TestParseTimeExpression(t *testing.T) {
+	// Thursday
+	now := time.Date(2025, 4, 24, 14, 35, 0, 0, time.UTC)
+	for _, test := range timeExpressionTests {
+		loc, err := time.LoadLocation(test.timezone)
+		require.NoError(t, err)
+		output, err := parseTimeExpression(test.input, now, loc)
+		require.NoError(t, err, test.input)
+		assert.Equal(t, test.expected, output.Format(time.RFC3339), test.input)
+	}
+}
+
+func TestParseTimeInstant(t *testing.T) {
+	// The modified times are not truncated to the hour
+	output, err := parseTimeInstant("2025-05-01T12:30:00Z", time.Now(), time.UTC)
+	require.NoError(t, err)
+	assert.Equal(t, "2025-05-01T12:30:00Z", output.Format(time.RFC3339))
+}
+
+func TestParseTimeExpressionInvalid(t *testing.T) {
+	for _, input := range []string{"2025-W54", "2025-W00", "-6x", "tomorrow", "2025-13"} {
+		_, err := parseTimeExpression(input, time.Now(), time.UTC)
+		assert.Error(t, err, input)
+	}
+}
@@ -0,0 +1,365 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const defaultWatchInterval = 5 * time.Minute
+const defaultWatchLag = time.Hour
+const watchReadHeaderTimeout = 10 * time.Second
+const watchShutdownTimeout = 5 * time.Second
+
+// Number of intervals without successful run after which the watch is unhealthy
+const watchUnhealthyIntervals = 3
+
+// watchStatus is the status of the watch loop exposed over HTTP
+type watchStatus struct {
+	mutex       sync.Mutex
+	Runs        int
+	Failures    int
+	LastRun     time.Time
+	LastSuccess time.Time
+	LastError   error
+	Cursor      time.Time
+	Metrics     metrics
+}
+
+// watch subcommand
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Continuously partition the new cloudfront log files",
+	Long: `Run the partitioning in a loop, for example as a long-lived kubernetes pod. This is a
+fallback for the S3 event notifications of the partitioning lambda.
+
+Every --interval the files of the hours since the last processed hour are partitioned, up to
+the current hour minus --lag (to let cloudfront deliver the logs of an hour). The last processed
+hour is saved in the --state-file, the first run starts at --timestamp-from (default the previous
+complete hour). The files already partitioned are skipped using the state file.
+
+--limit and --shard are not supported, the files not selected would never be partitioned as
+the processed hours are not partitioned again. With --sample the files not in the sample are
+permanently skipped.
+
+The health (/healthz) and the metrics in prometheus format (/metrics) are served on --listen.
+
+Examples:
+	cloudfront-logs watch --profile swisstopo-bgdi-dev --bucket swisstopo-bgdi-dev-cloudfront-logs-v2 \
+	--state-file /data/cloudfront-logs.db --interval 10m --lag 2h --listen :8080
+`,
+	Args: cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		err := checkWatchFlags(cmd)
+		if err != nil {
+			return err
+		}
+		conf, err := newPartionConfig(cmd)
+		if err != nil {
+			return err
+		}
+		interval, err := cmd.Flags().GetDuration("interval")
+		if err != nil {
+			return err
+		}
+		lag, err := cmd.Flags().GetDuration("lag")
+		if err != nil {
+			return err
+		}
+
+		state, err := NewStateStore(conf.StateFile)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = state.Close() }()
+
+		status := &watchStatus{}
+		status.Cursor, err = initialWatchCursor(state, conf, time.Now(), lag)
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		listen := cmd.Flag("listen").Value.String()
+		if listen != "" {
+			server := &http.Server{
+				Addr:              listen,
+				Handler:           newWatchMux(status, interval),
+				ReadHeaderTimeout: watchReadHeaderTimeout,
+			}
+			go func() {
+				e := server.ListenAndServe()
+				if e != nil && !errors.Is(e, http.ErrServerClosed) {
+					fmt.Fprintf(os.Stderr, "HTTP server error: %s\n", e)
+					stop()
+				}
+			}()
+			defer func() {
+				shutdownCtx, cancel := context.WithTimeout(context.Background(), watchShutdownTimeout)
+				defer cancel()
+				_ = server.Shutdown(shutdownCtx)
+			}()
+		}
+
+		if !conf.SkipPreflight {
+			err = runPreflight(ctx, conf)
+			if err != nil {
+				return err
+			}
+		}
+
+		printStart(conf, time.Now())
+		fmt.Printf("Watching every %s with a lag of %s, starting at %s\n",
+			interval, lag, status.Cursor.Format("2006-01-02 15:04 MST"))
+
+		return runWatch(ctx, conf, state, status, interval, lag)
+	},
+}
+
+//-----------------------------------------------------------------------------
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+
+	addWatchFlags(watchCmd)
+
+	_ = watchCmd.MarkFlagRequired("state-file")
+}
+
+// Adds the partition flags and the watch flags to the command
+func addWatchFlags(cmd *cobra.Command) {
+	addPartitionFlags(cmd)
+	cmd.Flags().Duration("interval", defaultWatchInterval, "Interval between two partitioning runs")
+	cmd.Flags().Duration("lag", defaultWatchLag, `Hours more recent than now minus the lag are not
+	partitioned yet`)
+	cmd.Flags().String("listen", ":8080", "Address of the health and metrics HTTP server (empty to disable)")
+}
+
+//-----------------------------------------------------------------------------
+
+// Rejects the partition flags that don't work with the watch cursor: the cursor moves past
+// the processed hours, so the files dropped by --limit or --shard would never be partitioned.
+// Also rejects a non-positive --interval and a negative --lag.
+func checkWatchFlags(cmd *cobra.Command) error {
+	if cmd.Flag("timestamp-to").Value.String() != "" || cmd.Flag("duration").Value.String() != "" {
+		return errors.New("--timestamp-to and --duration are not supported by watch")
+	}
+	if cmd.Flags().Changed("limit") || cmd.Flags().Changed("shard") {
+		return errors.New("--limit and --shard are not supported by watch")
+	}
+	interval, err := cmd.Flags().GetDuration("interval")
+	if err != nil {
+		return err
+	}
+	if interval <= 0 {
+		return fmt.Errorf("invalid --interval %s, must be > 0", interval)
+	}
+	lag, err := cmd.Flags().GetDuration("lag")
+	if err != nil {
+		return err
+	}
+	if lag < 0 {
+		return fmt.Errorf("invalid --lag %s, must be >= 0", lag)
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+// Returns the name of the cursor of the config in the state store
+func watchCursorName(conf partitionConfig) string {
+	return conf.S3Bucket + "/" + conf.S3Prefix
+}
+
+// Returns the hour from which the watch starts: the saved cursor, --timestamp-from or the
+// previous complete hour.
+func initialWatchCursor(state *StateStore, conf partitionConfig, now time.Time, lag time.Duration) (time.Time, error) {
+	cursor, err := state.Cursor(watchCursorName(conf))
+	if err != nil || !cursor.IsZero() {
+		return cursor, err
+	}
+	if !conf.TimeFrom.IsZero() {
+		return conf.TimeFrom.UTC(), nil
+	}
+	_, end := watchWindow(time.Time{}, now, lag)
+	return end.Add(-time.Hour), nil
+}
+
+// Returns the window [cursor, now - lag) of the next run, truncated to the hour
+func watchWindow(cursor, now time.Time, lag time.Duration) (time.Time, time.Time) {
+	return cursor, now.Add(-lag).UTC().Truncate(time.Hour)
+}
+
+func runWatch(
+	ctx context.Context,
+	conf partitionConfig,
+	state *StateStore,
+	status *watchStatus,
+	interval time.Duration,
+	lag time.Duration,
+) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		err := runWatchOnce(ctx, conf, state, status, lag)
+		if err != nil {
+			fmt.Printf("%s - Partitioning failed: %s\n", time.Now().Format("2006-01-02 15:04:05"), err)
+		}
+
+		select {
+		case <-ctx.Done():
+			fmt.Printf("%s - Watch stopped\n", time.Now().Format("2006-01-02 15:04:05"))
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Partitions the window since the cursor and moves the cursor to the end of the window
+// on success
+func runWatchOnce(
+	ctx context.Context,
+	conf partitionConfig,
+	state *StateStore,
+	status *watchStatus,
+	lag time.Duration,
+) error {
+	timeStart := time.Now()
+
+	status.mutex.Lock()
+	from, to := watchWindow(status.Cursor, timeStart, lag)
+	status.mutex.Unlock()
+	if !from.Before(to) {
+		status.update(timeStart, from, metrics{}, nil)
+		return nil
+	}
+	conf.TimeFrom = from
+	conf.TimeTo = to
+
+	ch := make(chan metrics)
+	var m metrics
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		m = collectMetrics(ch, timeStart, false)
+		wg.Done()
+	}()
+
+	err := runPartition(ctx, conf, state, ch)
+
+	close(ch)
+	wg.Wait()
+	m.Durations.Total = time.Since(timeStart)
+
+	if err == nil {
+		err = state.SetCursor(watchCursorName(conf), to)
+	}
+	if err != nil {
+		status.update(timeStart, from, m, err)
+		return err
+	}
+	status.update(timeStart, to, m, nil)
+
+	fmt.Printf("%s - Partitioned %s: %d files fetched, %d files partitioned in %s\n",
+		time.Now().Format("2006-01-02 15:04:05"),
+		formatTimeWindow(from, to),
+		m.Counters.Files.Fetched,
+		m.Counters.Files.Partitioned,
+		m.Durations.Total.Round(time.Millisecond),
+	)
+	return nil
+}
+
+// Updates the status with the result of a run
+func (status *watchStatus) update(runAt, cursor time.Time, m metrics, err error) {
+	status.mutex.Lock()
+	defer status.mutex.Unlock()
+
+	status.Runs++
+	status.LastRun = runAt
+	status.LastError = err
+	status.Cursor = cursor
+	if err != nil {
+		status.Failures++
+	} else {
+		status.LastSuccess = runAt
+	}
+	status.Metrics.add(m)
+}
+
+// Returns the handlers of the health and metrics endpoints
+func newWatchMux(status *watchStatus, interval time.Duration) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		status.mutex.Lock()
+		defer status.mutex.Unlock()
+
+		w.Header().Set("Content-Type", "text/plain")
+		// Healthy until the first run and as long as a run succeeded recently
+		since := time.Since(status.LastSuccess)
+		if status.Runs > 0 && since > watchUnhealthyIntervals*interval {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = fmt.Fprintf(w, "unhealthy: no successful run since %s, last error: %v\n",
+				since.Round(time.Second), status.LastError)
+			return
+		}
+		_, _ = fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+		status.mutex.Lock()
+		defer status.mutex.Unlock()
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeWatchMetrics(w, status, time.Now())
+	})
+	return mux
+}
+
+// Writes the metrics of the status in the prometheus text format
+func writeWatchMetrics(w io.Writer, status *watchStatus, now time.Time) {
+	counters := status.Metrics.Counters
+	metric := func(name, kind, help string, value any) {
+		_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, kind, name, value)
+	}
+	unix := func(t time.Time) int64 {
+		if t.IsZero() {
+			return 0
+		}
+		return t.Unix()
+	}
+
+	metric("cloudfront_logs_watch_runs_total", "counter", "Number of partitioning runs.", status.Runs)
+	metric("cloudfront_logs_watch_failures_total", "counter", "Number of failed partitioning runs.", status.Failures)
+	metric("cloudfront_logs_watch_last_run_timestamp_seconds", "gauge",
+		"Time of the last partitioning run.", unix(status.LastRun))
+	metric("cloudfront_logs_watch_last_success_timestamp_seconds", "gauge",
+		"Time of the last successful partitioning run.", unix(status.LastSuccess))
+	metric("cloudfront_logs_watch_cursor_timestamp_seconds", "gauge",
+		"Hour up to which the files have been partitioned.", unix(status.Cursor))
+	metric("cloudfront_logs_watch_lag_seconds", "gauge",
+		"Time since the hour up to which the files have been partitioned.", int64(now.Sub(status.Cursor).Seconds()))
+	metric("cloudfront_logs_watch_pages_total", "counter", "Number of s3 pages fetched.", counters.Pages)
+	metric("cloudfront_logs_watch_files_fetched_total", "counter", "Number of files fetched.", counters.Files.Fetched)
+	metric("cloudfront_logs_watch_files_partitioned_total", "counter",
+		"Number of files sent for partitioning.", counters.Files.Partitioned)
+	metric("cloudfront_logs_watch_files_skipped_total", "counter",
+		"Number of files out of the time windows.", counters.Files.Skipped)
+	metric("cloudfront_logs_watch_files_already_partitioned_total", "counter",
+		"Number of files already partitioned according to the state file.", counters.Files.AlreadyPartitioned)
+	metric("cloudfront_logs_watch_files_filtered_total", "counter",
+		"Number of files excluded by the object filters.", status.Metrics.filteredFiles())
+	metric("cloudfront_logs_watch_files_sampled_out_total", "counter",
+		"Number of files excluded by the sampling options.", status.Metrics.sampledOutFiles())
+}
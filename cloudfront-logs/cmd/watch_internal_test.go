@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchCursor(t *testing.T) {
+	state, err := NewStateStore(filepath.Join(t.TempDir(), "state.db"))
+	require.NoError(t, err)
+	defer func() { _ = state.Close() }()
+
+	now := time.Date(2025, 4, 24, 14, 35, 0, 0, time.UTC)
+	conf := partitionConfig{S3Bucket: "bucket", S3Prefix: "prefix"}
+
+	// Previous complete hour before the lag
+	cursor, err := initialWatchCursor(state, conf, now, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2025, 4, 24, 12, 0, 0, 0, time.UTC), cursor)
+
+	// --timestamp-from
+	conf.TimeFrom = time.Date(2025, 4, 20, 0, 0, 0, 0, time.UTC)
+	cursor, err = initialWatchCursor(state, conf, now, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, conf.TimeFrom, cursor)
+
+	// Saved cursor
+	saved := time.Date(2025, 4, 23, 5, 0, 0, 0, time.UTC)
+	require.NoError(t, state.SetCursor(watchCursorName(conf), saved))
+	cursor, err = initialWatchCursor(state, conf, now, time.Hour)
+	require.NoError(t, err)
+	assert.True(t, saved.Equal(cursor))
+
+	from, to := watchWindow(saved, now, 2*time.Hour)
+	assert.Equal(t, saved, from)
+	assert.Equal(t, time.Date(2025, 4, 24, 12, 0, 0, 0, time.UTC), to)
+}
+
+func TestWatchMux(t *testing.T) {
+	status := &watchStatus{}
+	mux := newWatchMux(status, time.Minute)
+	get := func(path string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		return recorder
+	}
+
+	// Healthy before the first run
+	assert.Equal(t, http.StatusOK, get("/healthz").Code)
+
+	m := metrics{}
+	m.Counters.Files.Partitioned = 12
+	status.update(time.Now(), time.Now().Add(-time.Hour), m, nil)
+	assert.Equal(t, http.StatusOK, get("/healthz").Code)
+
+	status.update(time.Now(), time.Now().Add(-time.Hour), metrics{}, errors.New("failed"))
+	status.LastSuccess = time.Now().Add(-time.Hour)
+	assert.Equal(t, http.StatusServiceUnavailable, get("/healthz").Code)
+
+	body := get("/metrics").Body.String()
+	assert.Contains(t, body, "cloudfront_logs_watch_runs_total 2\n")
+	assert.Contains(t, body, "cloudfront_logs_watch_failures_total 1\n")
+	assert.Contains(t, body, "cloudfront_logs_watch_files_partitioned_total 12\n")
+	assert.Contains(t, body, "# TYPE cloudfront_logs_watch_lag_seconds gauge\n")
+}
+
+func TestCheckWatchFlags(t *testing.T) {
+	for _, tc := range []struct {
+		args  []string
+		valid bool
+	}{
+		{[]string{"--timestamp-from", "2025-04-24-12"}, true},
+		{[]string{"--sample", "0.5"}, true},
+		{[]string{"--timestamp-to", "2025-04-24-12"}, false},
+		{[]string{"--duration", "1h"}, false},
+		// The files dropped by the limit or not in the shard would never be partitioned
+		{[]string{"--limit", "10"}, false},
+		{[]string{"--shard", "1/2"}, false},
+		{[]string{"--interval", "1m", "--lag", "0"}, true},
+		{[]string{"--interval", "0"}, false},
+		{[]string{"--interval", "-5m"}, false},
+		{[]string{"--lag", "-1h"}, false},
+	} {
+		cmd := &cobra.Command{}
+		addWatchFlags(cmd)
+		require.NoError(t, cmd.ParseFlags(tc.args))
+		err := checkWatchFlags(cmd)
+		if tc.valid {
+			assert.NoError(t, err, tc.args)
+		} else {
+			assert.Error(t, err, tc.args)
+		}
+	}
+}
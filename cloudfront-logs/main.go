@@ -1,6 +1,11 @@
 package main
 
-import "github.com/geoadmin/tool-golang-bgdi/cloudfront-logs/cmd"
+import (
+	// Embed the time zone database for --timezone on systems without it (e.g. alpine)
+	_ "time/tzdata"
+
+	"github.com/geoadmin/tool-golang-bgdi/cloudfront-logs/cmd"
+)
 
 func main() {
 	cmd.Execute()
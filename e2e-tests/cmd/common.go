@@ -2,29 +2,83 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
 	"github.com/aws/aws-sdk-go-v2/service/codebuild"
 	"github.com/aws/aws-sdk-go-v2/service/codebuild/types"
-	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/geoadmin/tool-golang-bgdi/lib/awscfg"
 	"github.com/geoadmin/tool-golang-bgdi/lib/fmtc"
-	"github.com/geoadmin/tool-golang-bgdi/lib/str"
 	"github.com/spf13/cobra"
 )
 
 //----------------------------------------------------------------------------
 
+// Maximum number of report ARNs of a BatchGetReports call
+const maxBatchGetReports = 100
+
+// Maximum number of build IDs of a BatchGetBuilds call
+const maxBatchGetBuilds = 100
+
+// Maximum interval between two polls of the builds status
+const maxPollInterval = 30 * time.Second
+
+// Maximum number of transient errors in a row when polling the builds status
+const maxPollErrors = 5
+
+var errWaitTimeout = errors.New("timeout waiting for the E2E tests result")
+
+// Stagings having an E2E tests project
+var allStagings = []string{"dev", "int", "prod"}
+
+// CodeBuild API used by the commands, implemented by *codebuild.Client
+type codebuildAPI interface {
+	BatchGetBuilds(ctx context.Context, params *codebuild.BatchGetBuildsInput, optFns ...func(*codebuild.Options)) (
+		*codebuild.BatchGetBuildsOutput, error)
+	BatchGetReports(ctx context.Context, params *codebuild.BatchGetReportsInput, optFns ...func(*codebuild.Options)) (
+		*codebuild.BatchGetReportsOutput, error)
+	DescribeTestCases(
+		ctx context.Context,
+		params *codebuild.DescribeTestCasesInput,
+		optFns ...func(*codebuild.Options),
+	) (*codebuild.DescribeTestCasesOutput, error)
+	ListBuildsForProject(
+		ctx context.Context,
+		params *codebuild.ListBuildsForProjectInput,
+		optFns ...func(*codebuild.Options),
+	) (*codebuild.ListBuildsForProjectOutput, error)
+	StartBuild(ctx context.Context, params *codebuild.StartBuildInput, optFns ...func(*codebuild.Options)) (
+		*codebuild.StartBuildOutput, error)
+	StopBuild(ctx context.Context, params *codebuild.StopBuildInput, optFns ...func(*codebuild.Options)) (
+		*codebuild.StopBuildOutput, error)
+}
+
+//----------------------------------------------------------------------------
+
 var cPrintln func(c fmtc.Color, v ...any) = fmtc.Println
 var cPrintf func(c fmtc.Color, format string, v ...any) = fmtc.Printf
 
 //-----------------------------------------------------------------------------
 
+// Returns the --interval flag, at least 1 second to not poll the API continuously
+func getIntervalFlag(cmd *cobra.Command) (int, error) {
+	interval, e := cmd.Flags().GetInt("interval")
+	if e != nil {
+		return 0, e
+	}
+	if interval < 1 {
+		return 0, fmt.Errorf("invalid --interval %d, must be >= 1", interval)
+	}
+	return interval, nil
+}
+
 func initPrint(cmd *cobra.Command) error {
 	noColor, e := cmd.Flags().GetBool("no-color")
 	if e != nil {
@@ -48,102 +102,202 @@ func initPrint(cmd *cobra.Command) error {
 
 // Returns a CodeBuild client
 func getClient(ctx context.Context, cmd *cobra.Command) (*codebuild.Client, error) {
-	noProfile, e := cmd.Flags().GetBool("no-profile")
+	cfg, e := getAwsConfig(ctx, cmd)
+	if e != nil {
+		return nil, e
+	}
+
+	client := codebuild.NewFromConfig(cfg)
+
+	return client, nil
+}
+
+// Returns a CloudWatch Logs client
+func getLogsClient(ctx context.Context, cmd *cobra.Command) (*cloudwatchlogs.Client, error) {
+	cfg, e := getAwsConfig(ctx, cmd)
 	if e != nil {
 		return nil, e
 	}
+	return cloudwatchlogs.NewFromConfig(cfg), nil
+}
+
+// Returns the AWS config of the --no-profile and --role flags
+func getAwsConfig(ctx context.Context, cmd *cobra.Command) (aws.Config, error) {
+	noProfile, e := cmd.Flags().GetBool("no-profile")
+	if e != nil {
+		return aws.Config{}, e
+	}
 	role := cmd.Flag("role").Value.String()
-	var cfg aws.Config
 
-	switch {
-	case role != "":
-		var cred *sts.AssumeRoleOutput
-		cfg, e = config.LoadDefaultConfig(ctx, config.WithRegion("eu-central-1"))
-		if e != nil {
-			return nil, fmt.Errorf("failed to load configuration: %w", e)
-		}
+	opts := awscfg.Options{
+		Region:    "eu-central-1",
+		Profile:   "swisstopo-bgdi-builder",
+		NoProfile: noProfile,
+	}
+	if role != "" {
 		splittedRole := strings.Split(role, "/")
 		roleName := splittedRole[len(splittedRole)-1]
-		stsClient := sts.NewFromConfig(cfg)
-		cred, e = stsClient.AssumeRole(ctx, &sts.AssumeRoleInput{
-			RoleArn:         &role,
-			RoleSessionName: str.Ptr(fmt.Sprintf("ToolE2ETestsAssumeRole%s", roleName)),
-			DurationSeconds: aws.Int32(45 * 60), //nolint:mnd
-		})
-		if e != nil {
-			return nil, fmt.Errorf("failed to assume role %s: %w", role, e)
-		}
-
-		cfg, e = config.LoadDefaultConfig(ctx, config.WithCredentialsProvider(
-			credentials.NewStaticCredentialsProvider(
-				*cred.Credentials.AccessKeyId,
-				*cred.Credentials.SecretAccessKey,
-				*cred.Credentials.SessionToken,
-			),
-		))
-		if e != nil {
-			return nil, fmt.Errorf("failed to load configuration with role credentials: %w", e)
-		}
-	case noProfile:
-		cfg, e = config.LoadDefaultConfig(ctx, config.WithRegion("eu-central-1"))
-		if e != nil {
-			return nil, fmt.Errorf("failed to load configuration: %w", e)
-		}
-	default:
-		cfg, e = config.LoadDefaultConfig(ctx, config.WithSharedConfigProfile("swisstopo-bgdi-builder"))
-		if e != nil {
-			return nil, fmt.Errorf("failed to load configuration: %w", e)
-		}
+		opts.NoProfile = true
+		opts.RoleArn = role
+		opts.RoleSessionName = fmt.Sprintf("ToolE2ETestsAssumeRole%s", roleName)
+		opts.SessionDuration = 45 * time.Minute //nolint:mnd
 	}
 
-	client := codebuild.NewFromConfig(cfg)
-
-	return client, nil
+	return awscfg.LoadConfig(ctx, opts)
 }
 
 //-----------------------------------------------------------------------------
 
 func waitForBuild(
 	ctx context.Context,
-	client *codebuild.Client,
+	client codebuildAPI,
 	buildID string,
 	showProgress bool,
 	interval int,
+	timeout time.Duration,
 ) (*codebuild.BatchGetBuildsOutput, error) {
-	var result *codebuild.BatchGetBuildsOutput
-	var e error
-
-	input := &codebuild.BatchGetBuildsInput{
-		Ids: []string{buildID},
+	builds, e := waitForBuilds(ctx, client, []string{buildID}, showProgress, interval, timeout)
+	if e != nil {
+		return nil, e
 	}
-	c := 0
+	fmt.Printf("E2E tests finished with status: %s\n", builds[0].BuildStatus)
+
+	return &codebuild.BatchGetBuildsOutput{Builds: builds}, nil
+}
+
+// Waits until all the builds are complete and returns them in the order of the IDs. The
+// builds are polled every interval seconds, increased by half after each poll up to
+// maxPollInterval, transient errors are retried up to maxPollErrors times in a row. A
+// timeout of 0 waits without limit.
+func waitForBuilds(
+	ctx context.Context,
+	client codebuildAPI,
+	buildIDs []string,
+	showProgress bool,
+	interval int,
+	timeout time.Duration,
+) ([]types.Build, error) {
+	ctx, cancel := withWaitTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	delay := time.Duration(interval) * time.Second
+	maxDelay := max(delay, maxPollInterval)
+	pollErrors := pollRetry{}
+	progress := ""
 	for {
 		if showProgress {
-			cPrintf(fmtc.NoColor, "Waiting for result: %ds\r", c)
-			c += interval
+			cPrintf(fmtc.NoColor, "Waiting for result: %ds%s\r", int(time.Since(start).Seconds()), progress)
 		}
-		time.Sleep(time.Duration(interval) * time.Second)
-		result, e = client.BatchGetBuilds(ctx, input)
+		select {
+		case <-ctx.Done():
+			return nil, context.Cause(ctx)
+		case <-time.After(delay):
+		}
+		delay = min(delay+delay/2, maxDelay) //nolint:mnd
+
+		builds, e := getBuilds(ctx, client, buildIDs)
 		if e != nil {
-			return nil, fmt.Errorf("failed to get build status: %w", e)
+			if ctx.Err() != nil {
+				return nil, context.Cause(ctx)
+			}
+			if !pollErrors.retry(e) {
+				return nil, fmt.Errorf("failed to get build status: %w", e)
+			}
+			continue
 		}
-		if len(result.Builds) == 0 {
-			return nil, fmt.Errorf("no build found with id: %s", buildID)
+		pollErrors.reset()
+
+		if !slices.ContainsFunc(builds, func(b types.Build) bool { return !b.BuildComplete }) {
+			return builds, nil
 		}
-		if result.Builds[0].BuildComplete {
-			fmt.Printf("E2E tests finished with status: %s\n", result.Builds[0].BuildStatus)
-			break
+		progress = buildsProgress(builds)
+	}
+}
+
+// Returns the builds in the order of the IDs
+func getBuilds(ctx context.Context, client codebuildAPI, buildIDs []string) ([]types.Build, error) {
+	result, e := client.BatchGetBuilds(ctx, &codebuild.BatchGetBuildsInput{Ids: buildIDs})
+	if e != nil {
+		return nil, e
+	}
+	builds := make([]types.Build, len(buildIDs))
+	for i, id := range buildIDs {
+		j := slices.IndexFunc(result.Builds, func(b types.Build) bool { return aws.ToString(b.Id) == id })
+		if j < 0 {
+			return nil, fmt.Errorf("no build found with id: %s", id)
+		}
+		builds[i] = result.Builds[j]
+	}
+	return builds, nil
+}
+
+// Returns the context canceled with errWaitTimeout as cause after the timeout, ctx
+// without timeout (0)
+func withWaitTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeoutCause(ctx, timeout, fmt.Errorf("%w after %s", errWaitTimeout, timeout))
+}
+
+// Counts the consecutive errors of a polling loop
+type pollRetry struct {
+	errors int
+}
+
+// Returns true if the poll can be retried after the error: transient errors are retried
+// up to maxPollErrors times in a row
+func (r *pollRetry) retry(e error) bool {
+	r.errors++
+	return isTransientError(e) && r.errors <= maxPollErrors
+}
+
+// Resets the count after a successful poll
+func (r *pollRetry) reset() {
+	r.errors = 0
+}
+
+// Returns true if the error is a throttling or a transient (e.g. connection) error
+func isTransientError(e error) bool {
+	return retry.IsErrorThrottles(retry.DefaultThrottles).IsErrorThrottle(e) == aws.TrueTernary ||
+		retry.IsErrorRetryables(retry.DefaultRetryables).IsErrorRetryable(e) == aws.TrueTernary
+}
+
+// Returns the progress of the builds, the current phase of a single build (e.g. " (BUILD)")
+// or the staging and phase of each build.
+func buildsProgress(builds []types.Build) string {
+	progress := []string{}
+	for _, build := range builds {
+		phase := buildPhase(build)
+		if len(builds) > 1 {
+			phase = stagingFromProjectName(projectNameFromBuildID(aws.ToString(build.Id))) + " " + phase
 		}
+		progress = append(progress, phase)
 	}
+	return " (" + strings.Join(progress, ", ") + ")"
+}
 
-	return result, nil
+// Returns the current phase of the build (e.g. QUEUED, PROVISIONING, BUILD), its status
+// once complete
+func buildPhase(build types.Build) string {
+	switch {
+	case build.BuildComplete:
+		return string(build.BuildStatus)
+	case build.CurrentPhase != nil:
+		return *build.CurrentPhase
+	case len(build.Phases) > 0:
+		return string(build.Phases[len(build.Phases)-1].PhaseType)
+	default:
+		return string(build.BuildStatus)
+	}
 }
 
 //-----------------------------------------------------------------------------
 
 func printTestResult(
 	ctx context.Context,
-	client *codebuild.Client,
+	client codebuildAPI,
 	result *codebuild.BatchGetBuildsOutput,
 	detailed bool,
 ) error {
@@ -153,11 +307,21 @@ func printTestResult(
 	}
 	// If the build failed, print the reports
 	cPrintln(fmtc.Red, "E2E tests failed !")
-	for _, report := range result.Builds[0].ReportArns {
-		e := printTestReport(ctx, client, report, *result.Builds[0].Id, detailed)
-		if e != nil {
-			return e
+	reports, e := getReports(ctx, client, result.Builds[0].ReportArns)
+	if e != nil {
+		return e
+	}
+	total := testStatistics{}
+	for _, report := range reports {
+		stats, err := printTestReport(ctx, client, report, *result.Builds[0].Id, detailed)
+		if err != nil {
+			return err
 		}
+		total.add(stats)
+	}
+	if len(reports) > 1 {
+		cPrintf(fmtc.Red, "\nAll reports failures/errors %d%% (%d/%d)\n",
+			total.failurePercent(), total.Failed+total.Errors, total.Total)
 	}
 	// For E2E tests error we use exit code 2 to differentiate between e2e-tests command failure
 	return ErrTestFailed
@@ -165,67 +329,124 @@ func printTestResult(
 
 //-----------------------------------------------------------------------------
 
+// Number of tests of one or more reports
+type testStatistics struct {
+	Total  int
+	Failed int
+	Errors int
+}
+
+func (stats *testStatistics) add(other testStatistics) {
+	stats.Total += other.Total
+	stats.Failed += other.Failed
+	stats.Errors += other.Errors
+}
+
+func (stats testStatistics) failurePercent() int {
+	if stats.Total == 0 {
+		return 0
+	}
+	return (stats.Failed + stats.Errors) * 100 / stats.Total
+}
+
+//-----------------------------------------------------------------------------
+
 func printTestReport(
 	ctx context.Context,
-	client *codebuild.Client,
-	reportArn string,
+	client codebuildAPI,
+	report types.Report,
 	buildID string,
 	detailed bool,
-) error {
-	// Get the number of tests
-	input := &codebuild.BatchGetReportsInput{
-		ReportArns: []string{reportArn},
-	}
-	r, e := client.BatchGetReports(ctx, input)
-	if e != nil {
-		return fmt.Errorf("failed to describe test case for reportARN=%s: %w", reportArn, e)
+) (testStatistics, error) {
+	reportArn := aws.ToString(report.Arn)
+	stats := testStatistics{}
+	if report.TestSummary != nil {
+		stats.Total = int(aws.ToInt32(report.TestSummary.Total))
 	}
-	nbTests := int(*r.Reports[0].TestSummary.Total)
 
 	// First get the errors
-	nbErr, e := printTestReportByStatus(ctx, client, reportArn, "ERROR", detailed)
+	nbErr, e := printTestReportByStatus(ctx, client, reportArn, testStatusError, detailed)
 	if e != nil {
-		return e
+		return stats, e
 	}
+	stats.Errors = nbErr
 
 	// Then gets the failure
-	nbFails, e := printTestReportByStatus(ctx, client, reportArn, "FAILED", detailed)
+	nbFails, e := printTestReportByStatus(ctx, client, reportArn, testStatusFailed, detailed)
 	if e != nil {
-		return e
+		return stats, e
 	}
+	stats.Failed = nbFails
 
-	cPrintf(fmtc.Red, "\nTests failures/errors %d%% (%d/%d)\n", (nbErr+nbFails)*100/nbTests, nbErr+nbFails, nbTests)
+	cPrintf(fmtc.Red, "\nTests failures/errors %d%% (%d/%d)\n",
+		stats.failurePercent(), stats.Failed+stats.Errors, stats.Total)
 
 	cPrintln(fmtc.Red, "Test report link:")
 	cPrintln(fmtc.Red, "-----------------")
 	cPrintln(fmtc.Red, buildReportLink(projectNameFromBuildID(buildID), reportArn))
 
-	return nil
+	return stats, nil
 }
 
 //-----------------------------------------------------------------------------
 
 func printTestReportByStatus(
 	ctx context.Context,
-	client *codebuild.Client,
+	client codebuildAPI,
 	reportArn string,
 	status string,
 	detailed bool,
 ) (int, error) {
-	filter := &types.TestCaseFilter{
-		Status: &status,
+	tests, e := describeTestCases(ctx, client, reportArn, &types.TestCaseFilter{Status: &status})
+	if e != nil {
+		return 0, fmt.Errorf("failed to describe test case %s for reportARN=%s: %w", status, reportArn, e)
 	}
-	input := &codebuild.DescribeTestCasesInput{
+	printTestCases(tests, status, detailed)
+
+	return len(tests), nil
+}
+
+//-----------------------------------------------------------------------------
+
+// Returns all the test cases of the report matching the filter (nil for all test cases)
+func describeTestCases(
+	ctx context.Context,
+	client codebuildAPI,
+	reportArn string,
+	filter *types.TestCaseFilter,
+) ([]types.TestCase, error) {
+	tests := []types.TestCase{}
+	paginator := codebuild.NewDescribeTestCasesPaginator(client, &codebuild.DescribeTestCasesInput{
 		ReportArn: &reportArn,
 		Filter:    filter,
+	})
+	for paginator.HasMorePages() {
+		r, e := paginator.NextPage(ctx)
+		if e != nil {
+			return nil, e
+		}
+		tests = append(tests, r.TestCases...)
 	}
-	r, e := client.DescribeTestCases(ctx, input)
-	if e != nil {
-		return 0, fmt.Errorf("failed to describe test case %s for reportARN=%s: %w", status, reportArn, e)
-	}
-	printTestCases(r.TestCases, status, detailed)
+	return tests, nil
+}
+
+//-----------------------------------------------------------------------------
 
-	return len(r.TestCases), nil
+// Returns the reports of the ARNs, BatchGetReports is called with at most
+// maxBatchGetReports ARNs
+func getReports(ctx context.Context, client codebuildAPI, reportArns []string) ([]types.Report, error) {
+	reports := []types.Report{}
+	for chunk := range slices.Chunk(reportArns, maxBatchGetReports) {
+		r, e := client.BatchGetReports(ctx, &codebuild.BatchGetReportsInput{ReportArns: chunk})
+		if e != nil {
+			return nil, fmt.Errorf("failed to get reports %s: %w", strings.Join(chunk, ", "), e)
+		}
+		if len(r.ReportsNotFound) > 0 {
+			return nil, fmt.Errorf("reports not found: %s", strings.Join(r.ReportsNotFound, ", "))
+		}
+		reports = append(reports, r.Reports...)
+	}
+	return reports, nil
 }
 
 //-----------------------------------------------------------------------------
@@ -284,3 +505,10 @@ func projectNameFromBuildID(buildID string) string {
 }
 
 //-----------------------------------------------------------------------------
+
+// Returns the staging of the project name e2e-tests-<staging>-pr
+func stagingFromProjectName(project string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(project, "e2e-tests-"), "-pr")
+}
+
+//-----------------------------------------------------------------------------
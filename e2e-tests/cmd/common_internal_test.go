@@ -0,0 +1,254 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/codebuild"
+	"github.com/aws/aws-sdk-go-v2/service/codebuild/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Page size of the fake DescribeTestCases, as the real API
+const fakePageSize = 100
+
+// fakeCodeBuild is an in memory CodeBuild with paginated responses
+type fakeCodeBuild struct {
+	builds    map[string]types.Build
+	reports   map[string]types.Report
+	testCases map[string][]types.TestCase
+	// Status per project of the builds started, they are complete immediately
+	startStatuses map[string]types.StatusType
+	// Error per project of StartBuild
+	startErrs map[string]error
+	// Number of calls per API
+	calls map[string]int
+}
+
+func newFakeCodeBuild() *fakeCodeBuild {
+	return &fakeCodeBuild{
+		builds:        map[string]types.Build{},
+		reports:       map[string]types.Report{},
+		testCases:     map[string][]types.TestCase{},
+		startStatuses: map[string]types.StatusType{},
+		startErrs:     map[string]error{},
+		calls:         map[string]int{},
+	}
+}
+
+// Adds a report with the given number of test cases per status
+func (f *fakeCodeBuild) addReport(reportArn string, counts map[string]int) {
+	total := 0
+	for status, count := range counts {
+		for i := range count {
+			f.testCases[reportArn] = append(f.testCases[reportArn], types.TestCase{
+				ReportArn:             aws.String(reportArn),
+				Prefix:                aws.String("tests." + status),
+				Name:                  aws.String(fmt.Sprintf("test_%d", i)),
+				Status:                aws.String(status),
+				Message:               aws.String("message"),
+				DurationInNanoSeconds: aws.Int64(1_000_000_000),
+			})
+		}
+		total += count
+	}
+	f.reports[reportArn] = types.Report{
+		Arn:         aws.String(reportArn),
+		TestSummary: &types.TestReportSummary{Total: aws.Int32(int32(total))},
+	}
+}
+
+func (f *fakeCodeBuild) BatchGetBuilds(
+	_ context.Context, params *codebuild.BatchGetBuildsInput, _ ...func(*codebuild.Options),
+) (*codebuild.BatchGetBuildsOutput, error) {
+	f.calls["BatchGetBuilds"]++
+	output := &codebuild.BatchGetBuildsOutput{}
+	for _, id := range params.Ids {
+		if build, ok := f.builds[id]; ok {
+			output.Builds = append(output.Builds, build)
+		} else {
+			output.BuildsNotFound = append(output.BuildsNotFound, id)
+		}
+	}
+	return output, nil
+}
+
+func (f *fakeCodeBuild) BatchGetReports(
+	_ context.Context, params *codebuild.BatchGetReportsInput, _ ...func(*codebuild.Options),
+) (*codebuild.BatchGetReportsOutput, error) {
+	f.calls["BatchGetReports"]++
+	if len(params.ReportArns) > maxBatchGetReports {
+		return nil, fmt.Errorf("too many report ARNs: %d", len(params.ReportArns))
+	}
+	output := &codebuild.BatchGetReportsOutput{}
+	for _, arn := range params.ReportArns {
+		if report, ok := f.reports[arn]; ok {
+			output.Reports = append(output.Reports, report)
+		} else {
+			output.ReportsNotFound = append(output.ReportsNotFound, arn)
+		}
+	}
+	return output, nil
+}
+
+func (f *fakeCodeBuild) DescribeTestCases(
+	_ context.Context, params *codebuild.DescribeTestCasesInput, _ ...func(*codebuild.Options),
+) (*codebuild.DescribeTestCasesOutput, error) {
+	f.calls["DescribeTestCases"]++
+	tests := []types.TestCase{}
+	for _, t := range f.testCases[aws.ToString(params.ReportArn)] {
+		if params.Filter == nil || params.Filter.Status == nil || *params.Filter.Status == *t.Status {
+			tests = append(tests, t)
+		}
+	}
+
+	start := 0
+	if params.NextToken != nil {
+		var err error
+		start, err = strconv.Atoi(*params.NextToken)
+		if err != nil {
+			return nil, err
+		}
+	}
+	end := min(start+fakePageSize, len(tests))
+	output := &codebuild.DescribeTestCasesOutput{TestCases: tests[start:end]}
+	if end < len(tests) {
+		output.NextToken = aws.String(strconv.Itoa(end))
+	}
+	return output, nil
+}
+
+func (f *fakeCodeBuild) ListBuildsForProject(
+	_ context.Context, params *codebuild.ListBuildsForProjectInput, _ ...func(*codebuild.Options),
+) (*codebuild.ListBuildsForProjectOutput, error) {
+	f.calls["ListBuildsForProject"]++
+	builds := []types.Build{}
+	for _, build := range f.builds {
+		if aws.ToString(build.ProjectName) == aws.ToString(params.ProjectName) {
+			builds = append(builds, build)
+		}
+	}
+	// Newest first
+	slices.SortFunc(builds, func(a, b types.Build) int {
+		return aws.ToTime(b.StartTime).Compare(aws.ToTime(a.StartTime))
+	})
+
+	start := 0
+	if params.NextToken != nil {
+		var err error
+		start, err = strconv.Atoi(*params.NextToken)
+		if err != nil {
+			return nil, err
+		}
+	}
+	end := min(start+fakePageSize, len(builds))
+	output := &codebuild.ListBuildsForProjectOutput{}
+	for _, build := range builds[start:end] {
+		output.Ids = append(output.Ids, aws.ToString(build.Id))
+	}
+	if end < len(builds) {
+		output.NextToken = aws.String(strconv.Itoa(end))
+	}
+	return output, nil
+}
+
+func (f *fakeCodeBuild) StartBuild(
+	_ context.Context, params *codebuild.StartBuildInput, _ ...func(*codebuild.Options),
+) (*codebuild.StartBuildOutput, error) {
+	f.calls["StartBuild"]++
+	if e, ok := f.startErrs[aws.ToString(params.ProjectName)]; ok {
+		return nil, e
+	}
+	id := fmt.Sprintf("%s:%d", aws.ToString(params.ProjectName), len(f.builds)+1)
+	build := types.Build{Id: aws.String(id), ProjectName: params.ProjectName, BuildStatus: types.StatusTypeInProgress}
+	if status, ok := f.startStatuses[aws.ToString(params.ProjectName)]; ok {
+		build.BuildStatus = status
+		build.BuildComplete = true
+	}
+	f.builds[id] = build
+	return &codebuild.StartBuildOutput{Build: &build}, nil
+}
+
+func (f *fakeCodeBuild) StopBuild(
+	_ context.Context, params *codebuild.StopBuildInput, _ ...func(*codebuild.Options),
+) (*codebuild.StopBuildOutput, error) {
+	f.calls["StopBuild"]++
+	build, ok := f.builds[aws.ToString(params.Id)]
+	if !ok {
+		return nil, fmt.Errorf("build not found: %s", aws.ToString(params.Id))
+	}
+	if !build.BuildComplete {
+		build.BuildComplete = true
+		build.BuildStatus = types.StatusTypeStopped
+		f.builds[aws.ToString(params.Id)] = build
+	}
+	return &codebuild.StopBuildOutput{Build: &build}, nil
+}
+
+func fakeReportArn(i int) string {
+	return fmt.Sprintf("arn:aws:codebuild:eu-central-1:974517877189:report/e2e-tests-dev-pr-reports:%04d", i)
+}
+
+//-----------------------------------------------------------------------------
+
+func TestPrintTestReportPagination(t *testing.T) {
+	client := newFakeCodeBuild()
+	client.addReport(fakeReportArn(1), map[string]int{
+		testStatusSucceeded: 530,
+		testStatusFailed:    350,
+		testStatusError:     120,
+	})
+
+	stats, err := printTestReport(
+		context.Background(), client, client.reports[fakeReportArn(1)], "e2e-tests-dev-pr:1", false,
+	)
+	require.NoError(t, err)
+	assert.Equal(t, testStatistics{Total: 1000, Failed: 350, Errors: 120}, stats)
+	assert.Equal(t, 47, stats.failurePercent())
+	// 4 pages of failures and 2 pages of errors
+	assert.Equal(t, 6, client.calls["DescribeTestCases"])
+
+	tests, err := describeTestCases(context.Background(), client, fakeReportArn(1), nil)
+	require.NoError(t, err)
+	assert.Len(t, tests, 1000)
+}
+
+func TestPrintTestResultAggregatesReports(t *testing.T) {
+	client := newFakeCodeBuild()
+	arns := []string{}
+	for i := range 150 {
+		arn := fakeReportArn(i)
+		arns = append(arns, arn)
+		client.addReport(arn, map[string]int{testStatusSucceeded: 3, testStatusFailed: 1})
+	}
+	result := &codebuild.BatchGetBuildsOutput{Builds: []types.Build{{
+		Id:          aws.String("e2e-tests-dev-pr:1"),
+		BuildStatus: types.StatusTypeFailed,
+		ReportArns:  arns,
+	}}}
+
+	reports, err := getReports(context.Background(), client, arns)
+	require.NoError(t, err)
+	assert.Len(t, reports, 150)
+	assert.Equal(t, 2, client.calls["BatchGetReports"])
+
+	err = printTestResult(context.Background(), client, result, false)
+	require.ErrorIs(t, err, ErrTestFailed)
+
+	_, err = getReports(context.Background(), client, []string{"unknown"})
+	assert.Error(t, err)
+}
+
+func TestTestStatistics(t *testing.T) {
+	stats := testStatistics{}
+	assert.Equal(t, 0, stats.failurePercent())
+	stats.add(testStatistics{Total: 10, Failed: 1, Errors: 1})
+	stats.add(testStatistics{Total: 10, Failed: 2})
+	assert.Equal(t, testStatistics{Total: 20, Failed: 3, Errors: 1}, stats)
+	assert.Equal(t, 20, stats.failurePercent())
+}
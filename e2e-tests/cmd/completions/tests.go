@@ -33,6 +33,18 @@ func CompleteTests(_ *cobra.Command, _ []string, _ string) ([]cobra.Completion,
 
 //-----------------------------------------------------------------------------
 
+// TestModules returns the test modules of the E2E tests repository, without the
+// "tests." prefix (e.g. wms.test_getmap)
+func TestModules() ([]string, error) {
+	repoPath, err := getE2ERepo()
+	if err != nil {
+		return nil, fmt.Errorf("error finding git repo: %w", err)
+	}
+	return findTests(repoPath)
+}
+
+//-----------------------------------------------------------------------------
+
 func findTests(repoPath string) ([]string, error) {
 	var testNames []string
 	repoPath = fmt.Sprintf("%s/tests", repoPath)
@@ -0,0 +1,301 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/codebuild"
+	"github.com/aws/aws-sdk-go-v2/service/codebuild/types"
+	"github.com/geoadmin/tool-golang-bgdi/lib/fmtc"
+	"github.com/spf13/cobra"
+)
+
+const exportFileMode = 0o600
+
+// Test case status of the CodeBuild test reports
+const (
+	testStatusSucceeded = "SUCCEEDED"
+	testStatusFailed    = "FAILED"
+	testStatusError     = "ERROR"
+	testStatusSkipped   = "SKIPPED"
+)
+
+//-----------------------------------------------------------------------------
+
+// Full test result of a build, exported as JSON
+type testRunExport struct {
+	BuildID     string             `json:"buildId"`
+	BuildStatus string             `json:"buildStatus"`
+	LogLink     string             `json:"logLink"`
+	Reports     []testReportExport `json:"reports"`
+}
+
+type testReportExport struct {
+	Arn        string           `json:"arn"`
+	Name       string           `json:"name"`
+	Link       string           `json:"link"`
+	Total      int              `json:"total"`
+	Statuses   map[string]int   `json:"statuses"`
+	Duration   float64          `json:"durationSeconds"`
+	TestCases  []testCaseExport `json:"testCases"`
+	reportTime time.Time
+}
+
+type testCaseExport struct {
+	Suite    string  `json:"suite"`
+	Prefix   string  `json:"prefix"`
+	Name     string  `json:"name"`
+	Status   string  `json:"status"`
+	Duration float64 `json:"durationSeconds"`
+	Message  string  `json:"message,omitempty"`
+}
+
+//-----------------------------------------------------------------------------
+
+// JUnit XML format, see https://github.com/testmoapp/junitxml
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     float64          `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      float64         `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr,omitempty"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure"`
+	Error     *junitMessage `xml:"error"`
+	Skipped   *junitMessage `xml:"skipped"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+//-----------------------------------------------------------------------------
+
+// Adds the flags used by getExportFlags to the command
+func addExportFlags(cmd *cobra.Command) {
+	cmd.Flags().String("junit-file", "", "Write the full test report as JUnit XML to this file")
+	cmd.Flags().String("json-file", "", "Write the full test report as JSON to this file")
+}
+
+func getExportFlags(cmd *cobra.Command) (string, string) {
+	return cmd.Flag("junit-file").Value.String(), cmd.Flag("json-file").Value.String()
+}
+
+//-----------------------------------------------------------------------------
+
+// Writes the full test report of the build (all test cases of all reports) to the JUnit
+// XML and JSON files, an empty filename is not written.
+func exportTestResult(
+	ctx context.Context,
+	client codebuildAPI,
+	result *codebuild.BatchGetBuildsOutput,
+	junitFile string,
+	jsonFile string,
+) error {
+	if junitFile == "" && jsonFile == "" {
+		return nil
+	}
+
+	export, e := getTestRunExport(ctx, client, result.Builds[0])
+	if e != nil {
+		return e
+	}
+
+	if junitFile != "" {
+		e = writeJUnit(junitFile, export)
+		if e != nil {
+			return e
+		}
+		cPrintf(fmtc.NoColor, "JUnit test report written to %s\n", junitFile)
+	}
+	if jsonFile != "" {
+		d, err := json.MarshalIndent(export, "", "  ")
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(jsonFile, append(d, '\n'), exportFileMode)
+		if err != nil {
+			return fmt.Errorf("failed to write JSON test report %s: %w", jsonFile, err)
+		}
+		cPrintf(fmtc.NoColor, "JSON test report written to %s\n", jsonFile)
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+func getTestRunExport(ctx context.Context, client codebuildAPI, build types.Build) (testRunExport, error) {
+	export := testRunExport{
+		BuildID:     aws.ToString(build.Id),
+		BuildStatus: string(build.BuildStatus),
+		LogLink:     buildLogLink(aws.ToString(build.Id)),
+		Reports:     []testReportExport{},
+	}
+	if len(build.ReportArns) == 0 {
+		return export, nil
+	}
+
+	reports, e := getReports(ctx, client, build.ReportArns)
+	if e != nil {
+		return export, e
+	}
+	for _, report := range reports {
+		reportExport := newTestReportExport(report, projectNameFromBuildID(export.BuildID))
+
+		tests, err := describeTestCases(ctx, client, reportExport.Arn, nil)
+		if err != nil {
+			return export, fmt.Errorf("failed to describe test cases for reportARN=%s: %w", reportExport.Arn, err)
+		}
+		for _, t := range tests {
+			reportExport.TestCases = append(reportExport.TestCases, newTestCaseExport(t))
+		}
+
+		export.Reports = append(export.Reports, reportExport)
+	}
+	return export, nil
+}
+
+func newTestReportExport(report types.Report, project string) testReportExport {
+	reportExport := testReportExport{
+		Arn:        aws.ToString(report.Arn),
+		Name:       aws.ToString(report.Name),
+		Link:       buildReportLink(project, aws.ToString(report.Arn)),
+		Statuses:   map[string]int{},
+		TestCases:  []testCaseExport{},
+		reportTime: aws.ToTime(report.Created),
+	}
+	if report.TestSummary != nil {
+		reportExport.Total = int(aws.ToInt32(report.TestSummary.Total))
+		reportExport.Duration = nanoToSeconds(aws.ToInt64(report.TestSummary.DurationInNanoSeconds))
+		for status, count := range report.TestSummary.StatusCounts {
+			reportExport.Statuses[status] = int(count)
+		}
+	}
+	return reportExport
+}
+
+func newTestCaseExport(t types.TestCase) testCaseExport {
+	suite := aws.ToString(t.TestSuiteName)
+	if suite == "" {
+		suite = aws.ToString(t.Prefix)
+	}
+	return testCaseExport{
+		Suite:    suite,
+		Prefix:   aws.ToString(t.Prefix),
+		Name:     aws.ToString(t.Name),
+		Status:   aws.ToString(t.Status),
+		Duration: nanoToSeconds(aws.ToInt64(t.DurationInNanoSeconds)),
+		Message:  aws.ToString(t.Message),
+	}
+}
+
+func nanoToSeconds(nano int64) float64 {
+	return time.Duration(nano).Seconds()
+}
+
+//-----------------------------------------------------------------------------
+
+func writeJUnit(filename string, export testRunExport) error {
+	d, e := xml.MarshalIndent(newJUnitTestSuites(export), "", "  ")
+	if e != nil {
+		return e
+	}
+	e = os.WriteFile(filename, append([]byte(xml.Header), append(d, '\n')...), exportFileMode)
+	if e != nil {
+		return fmt.Errorf("failed to write JUnit test report %s: %w", filename, e)
+	}
+	return nil
+}
+
+// Returns the JUnit test suites of the export, one test suite per CodeBuild test suite
+// (or test prefix) and report
+func newJUnitTestSuites(export testRunExport) junitTestSuites {
+	suites := junitTestSuites{Name: export.BuildID}
+
+	for _, report := range export.Reports {
+		names := []string{}
+		byName := map[string]*junitTestSuite{}
+		for _, t := range report.TestCases {
+			suite, ok := byName[t.Suite]
+			if !ok {
+				suite = &junitTestSuite{Name: t.Suite}
+				if !report.reportTime.IsZero() {
+					suite.Timestamp = report.reportTime.UTC().Format(time.RFC3339)
+				}
+				byName[t.Suite] = suite
+				names = append(names, t.Suite)
+			}
+			testCase := newJUnitTestCase(t)
+			suite.TestCases = append(suite.TestCases, testCase)
+			suite.Tests++
+			suite.Time += t.Duration
+			switch {
+			case testCase.Failure != nil:
+				suite.Failures++
+			case testCase.Error != nil:
+				suite.Errors++
+			case testCase.Skipped != nil:
+				suite.Skipped++
+			}
+		}
+
+		slices.Sort(names)
+		for _, name := range names {
+			suite := byName[name]
+			suites.Suites = append(suites.Suites, *suite)
+			suites.Tests += suite.Tests
+			suites.Failures += suite.Failures
+			suites.Errors += suite.Errors
+			suites.Skipped += suite.Skipped
+			suites.Time += suite.Time
+		}
+	}
+	return suites
+}
+
+func newJUnitTestCase(t testCaseExport) junitTestCase {
+	testCase := junitTestCase{Name: t.Name, ClassName: t.Prefix, Time: t.Duration}
+	switch t.Status {
+	case testStatusSucceeded:
+	case testStatusFailed:
+		testCase.Failure = &junitMessage{Message: firstLine(t.Message), Text: t.Message}
+	case testStatusSkipped:
+		testCase.Skipped = &junitMessage{Message: firstLine(t.Message)}
+	default:
+		// ERROR and unknown statuses
+		testCase.Error = &junitMessage{Message: firstLine(t.Message), Text: t.Message}
+	}
+	return testCase
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/codebuild/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewJUnitTestSuites(t *testing.T) {
+	testCase := func(prefix, name, status, message string) testCaseExport {
+		return newTestCaseExport(types.TestCase{
+			Prefix:                aws.String(prefix),
+			Name:                  aws.String(name),
+			Status:                aws.String(status),
+			Message:               aws.String(message),
+			DurationInNanoSeconds: aws.Int64(1_500_000_000),
+		})
+	}
+	export := testRunExport{
+		BuildID: "e2e-tests-dev-pr:1234",
+		Reports: []testReportExport{
+			{
+				TestCases: []testCaseExport{
+					testCase("tests.b", "test_ok", testStatusSucceeded, ""),
+					testCase("tests.a", "test_fail", testStatusFailed, "assert failed\ndetails"),
+					testCase("tests.a", "test_error", testStatusError, "timeout"),
+					testCase("tests.a", "test_skip", testStatusSkipped, "not on dev"),
+				},
+			},
+		},
+	}
+
+	suites := newJUnitTestSuites(export)
+	assert.Equal(t, 4, suites.Tests)
+	assert.Equal(t, 1, suites.Failures)
+	assert.Equal(t, 1, suites.Errors)
+	assert.Equal(t, 1, suites.Skipped)
+	assert.InDelta(t, 6.0, suites.Time, 0.001)
+	require.Len(t, suites.Suites, 2)
+	assert.Equal(t, "tests.a", suites.Suites[0].Name)
+	assert.Equal(t, 3, suites.Suites[0].Tests)
+
+	d, err := xml.Marshal(suites.Suites[0].TestCases[0])
+	require.NoError(t, err)
+	assert.Equal(t, `<junitTestCase name="test_fail" classname="tests.a" time="1.5">`+
+		`<failure message="assert failed">assert failed&#xA;details</failure></junitTestCase>`, string(d))
+}
@@ -0,0 +1,327 @@
+package cmd
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/codebuild/types"
+	"github.com/geoadmin/tool-golang-bgdi/lib/fmtc"
+	"github.com/spf13/cobra"
+)
+
+//-----------------------------------------------------------------------------
+
+type FlakyCmdFlags struct {
+	Stagings []string
+	Runs     int
+	All      bool
+	Format   string
+}
+
+// Results of a test across the scanned runs of a staging
+type testHistory struct {
+	Staging     string   `json:"staging"`
+	Test        string   `json:"test"`
+	Runs        int      `json:"runs"`
+	Passed      int      `json:"passed"`
+	Failed      int      `json:"failed"`
+	PassRate    float64  `json:"passRate"`
+	Flips       int      `json:"flips"`
+	AvgDuration float64  `json:"avgDurationSeconds"`
+	Flaky       bool     `json:"flaky"`
+	Revisions   []string `json:"flakyRevisions"`
+	// Status of the last run (passed or not) to count the flips
+	lastPassed    bool
+	totalDuration float64
+	// Passed and failed results per commit
+	passedCommits map[string]bool
+	failedCommits map[string]bool
+}
+
+//-----------------------------------------------------------------------------
+
+// flakyCmd represents the flaky command
+var flakyCmd = &cobra.Command{
+	Use:   "flaky",
+	Short: "Detect the flaky tests of the recent E2E tests runs",
+	Long: `Scan the test reports of the last runs of each staging and compute per test the pass rate,
+the number of flips (passed then failed or failed then passed between two consecutive runs) and
+the average duration.
+
+A test is flaky when it both passed and failed on the same revision. The flaky tests are ranked
+by number of flips and pass rate, with --all the tests that failed at least once are also listed.
+
+Examples:
+	e2e-tests flaky
+	e2e-tests flaky --staging dev --runs 50 --format json`,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		e := initPrint(cmd)
+		if e != nil {
+			return e
+		}
+		flags, e := getCmdFlakyFlags(cmd)
+		if e != nil {
+			return e
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop() // Ensure cleanup
+
+		client, e := getClient(ctx, cmd)
+		if e != nil {
+			return e
+		}
+
+		histories := []*testHistory{}
+		for _, staging := range flags.Stagings {
+			cPrintf(fmtc.NoColor, "Scanning the last %d E2E tests runs of %s...\n", flags.Runs, staging)
+			h, err := getTestHistories(ctx, client, staging, flags.Runs)
+			if err != nil {
+				return err
+			}
+			histories = append(histories, h...)
+		}
+		return printTestHistories(cmd.OutOrStdout(), rankTestHistories(histories, flags.All), flags.Format)
+	},
+	ValidArgsFunction: func(_ *cobra.Command, _ []string, _ string) ([]cobra.Completion, cobra.ShellCompDirective) {
+		// Avoid doing file/folder completion after the command
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	},
+}
+
+//-----------------------------------------------------------------------------
+
+func init() {
+	rootCmd.AddCommand(flakyCmd)
+
+	flakyCmd.Flags().StringSliceP("staging", "s", allStagings, "Stagings of the tests runs")
+	flakyCmd.Flags().IntP("runs", "n", 20, "Number of last finished tests runs to scan per staging") //nolint:mnd
+	flakyCmd.Flags().Bool("all", false, "List all tests that failed at least once, not only the flaky ones")
+	flakyCmd.Flags().String("format", outputFormatTable, "Output format: table or json")
+
+	// Completions functions
+	_ = flakyCmd.RegisterFlagCompletionFunc(
+		"staging",
+		func(_ *cobra.Command, _ []string, _ string) ([]cobra.Completion, cobra.ShellCompDirective,
+		) {
+			return allStagings, cobra.ShellCompDirectiveNoFileComp
+		})
+	_ = flakyCmd.RegisterFlagCompletionFunc(
+		"format",
+		func(_ *cobra.Command, _ []string, _ string) ([]cobra.Completion, cobra.ShellCompDirective,
+		) {
+			return []cobra.Completion{outputFormatTable, outputFormatJSON}, cobra.ShellCompDirectiveNoFileComp
+		})
+}
+
+//-----------------------------------------------------------------------------
+
+func getCmdFlakyFlags(cmd *cobra.Command) (FlakyCmdFlags, error) {
+	var flags FlakyCmdFlags
+	stagings, e := cmd.Flags().GetStringSlice("staging")
+	if e != nil {
+		return FlakyCmdFlags{}, e
+	}
+	flags.Stagings = stagings
+
+	flags.Runs, e = cmd.Flags().GetInt("runs")
+	if e != nil {
+		return FlakyCmdFlags{}, e
+	}
+	if flags.Runs < 1 {
+		return FlakyCmdFlags{}, fmt.Errorf("invalid --runs %d, must be >= 1", flags.Runs)
+	}
+
+	flags.All, e = cmd.Flags().GetBool("all")
+	if e != nil {
+		return FlakyCmdFlags{}, e
+	}
+
+	flags.Format = cmd.Flag("format").Value.String()
+	if flags.Format != outputFormatTable && flags.Format != outputFormatJSON {
+		return FlakyCmdFlags{}, fmt.Errorf("invalid --format %s, must be %s or %s",
+			flags.Format, outputFormatTable, outputFormatJSON)
+	}
+
+	return flags, nil
+}
+
+//-----------------------------------------------------------------------------
+
+// Returns the history of all the tests of the last finished runs of the staging
+func getTestHistories(ctx context.Context, client codebuildAPI, staging string, runs int) ([]*testHistory, error) {
+	finished, e := listTestRuns(ctx, client, ListCmdFlags{Stagings: []string{staging}, Limit: runs, finished: true},
+		time.Now())
+	if e != nil {
+		return nil, e
+	}
+
+	// Oldest run first to count the flips
+	slices.Reverse(finished)
+	histories := map[string]*testHistory{}
+	names := []string{}
+	for _, run := range finished {
+		tests, err := getRunTestCases(ctx, client, run)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range tests {
+			name := aws.ToString(t.Prefix) + "." + aws.ToString(t.Name)
+			history, ok := histories[name]
+			if !ok {
+				history = &testHistory{
+					Staging:       staging,
+					Test:          name,
+					passedCommits: map[string]bool{},
+					failedCommits: map[string]bool{},
+				}
+				histories[name] = history
+				names = append(names, name)
+			}
+			history.add(run.commit, t)
+		}
+	}
+
+	result := []*testHistory{}
+	for _, name := range names {
+		result = append(result, histories[name].finalize())
+	}
+	return result, nil
+}
+
+// Returns all the test cases of all the reports of the run
+func getRunTestCases(ctx context.Context, client codebuildAPI, run testRunSummary) ([]types.TestCase, error) {
+	reports, e := getReports(ctx, client, run.reportArns)
+	if e != nil {
+		return nil, e
+	}
+	tests := []types.TestCase{}
+	for _, report := range reports {
+		t, err := describeTestCases(ctx, client, aws.ToString(report.Arn), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe test cases for reportARN=%s: %w", aws.ToString(report.Arn), err)
+		}
+		tests = append(tests, t...)
+	}
+	return tests, nil
+}
+
+// Adds the result of the test in a run of the commit, skipped tests are ignored
+func (h *testHistory) add(commit string, t types.TestCase) {
+	status := aws.ToString(t.Status)
+	if status == testStatusSkipped {
+		return
+	}
+	passed := status == testStatusSucceeded
+	if h.Runs > 0 && passed != h.lastPassed {
+		h.Flips++
+	}
+	h.Runs++
+	h.lastPassed = passed
+	h.totalDuration += nanoToSeconds(aws.ToInt64(t.DurationInNanoSeconds))
+	if passed {
+		h.Passed++
+		h.passedCommits[commit] = true
+	} else {
+		h.Failed++
+		h.failedCommits[commit] = true
+	}
+}
+
+// Computes the rates and the flaky revisions
+func (h *testHistory) finalize() *testHistory {
+	h.Revisions = []string{}
+	if h.Runs > 0 {
+		h.PassRate = float64(h.Passed) / float64(h.Runs)
+		h.AvgDuration = h.totalDuration / float64(h.Runs)
+	}
+	for commit := range h.failedCommits {
+		if h.passedCommits[commit] {
+			h.Revisions = append(h.Revisions, commit)
+		}
+	}
+	slices.Sort(h.Revisions)
+	h.Flaky = len(h.Revisions) > 0
+	return h
+}
+
+// Returns the flaky tests (or all tests that failed at least once) ranked by flips, pass
+// rate and name
+func rankTestHistories(histories []*testHistory, all bool) []testHistory {
+	ranked := []testHistory{}
+	for _, h := range histories {
+		if h.Flaky || (all && h.Failed > 0) {
+			ranked = append(ranked, *h)
+		}
+	}
+	slices.SortStableFunc(ranked, func(a, b testHistory) int {
+		if a.Flaky != b.Flaky {
+			if a.Flaky {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Or(
+			cmp.Compare(b.Flips, a.Flips),
+			cmp.Compare(a.PassRate, b.PassRate),
+			cmp.Compare(a.Staging, b.Staging),
+			cmp.Compare(a.Test, b.Test),
+		)
+	})
+	return ranked
+}
+
+//-----------------------------------------------------------------------------
+
+func printTestHistories(writer io.Writer, histories []testHistory, format string) error {
+	if format == outputFormatJSON {
+		d, e := json.MarshalIndent(histories, "", "  ")
+		if e != nil {
+			return e
+		}
+		_, e = fmt.Fprintln(writer, string(d))
+		return e
+	}
+
+	if len(histories) == 0 {
+		_, e := fmt.Fprintln(writer, "No flaky tests found")
+		return e
+	}
+	_, e := fmt.Fprintf(writer, "%-7s %-5s %5s %6s %6s %6s %6s %9s %s\n",
+		"STAGING", "FLAKY", "RUNS", "PASSED", "PASS%", "FAILED", "FLIPS", "AVG", "TEST")
+	if e != nil {
+		return e
+	}
+	for _, h := range histories {
+		flaky := "no"
+		if h.Flaky {
+			flaky = "yes"
+		}
+		_, e = fmt.Fprintf(writer, "%-7s %-5s %5d %6d %5.0f%% %6d %6d %9s %s\n",
+			h.Staging,
+			flaky,
+			h.Runs,
+			h.Passed,
+			h.PassRate*100, //nolint:mnd
+			h.Failed,
+			h.Flips,
+			time.Duration(h.AvgDuration*float64(time.Second)).Round(time.Millisecond),
+			h.Test,
+		)
+		if e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/codebuild/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Adds a finished build of the commit with one report with the test statuses
+func addTestRun(client *fakeCodeBuild, i int, commit string, start time.Time, statuses map[string]string) {
+	id := fmt.Sprintf("e2e-tests-dev-pr:%04d", i)
+	arn := fakeReportArn(i)
+	for name, status := range statuses {
+		client.testCases[arn] = append(client.testCases[arn], types.TestCase{
+			Prefix:                aws.String("tests.wms.TestGetMap"),
+			Name:                  aws.String(name),
+			Status:                aws.String(status),
+			DurationInNanoSeconds: aws.Int64(int64(i+1) * 1_000_000_000),
+		})
+	}
+	client.reports[arn] = types.Report{Arn: aws.String(arn)}
+	client.builds[id] = types.Build{
+		Id:                    aws.String(id),
+		ProjectName:           aws.String("e2e-tests-dev-pr"),
+		BuildStatus:           types.StatusTypeFailed,
+		BuildComplete:         true,
+		StartTime:             aws.Time(start.Add(time.Duration(i) * time.Hour)),
+		SourceVersion:         aws.String("master"),
+		ResolvedSourceVersion: aws.String(commit),
+		ReportArns:            []string{arn},
+	}
+}
+
+func TestFlakyTests(t *testing.T) {
+	start := time.Now().Add(-24 * time.Hour)
+	client := newFakeCodeBuild()
+	addTestRun(client, 0, "a", start, map[string]string{
+		"test_flaky": testStatusSucceeded, "test_broken": testStatusFailed, "test_ok": testStatusSucceeded,
+	})
+	addTestRun(client, 1, "a", start, map[string]string{
+		"test_flaky": testStatusError, "test_broken": testStatusFailed, "test_ok": testStatusSucceeded,
+	})
+	addTestRun(client, 2, "b", start, map[string]string{
+		"test_flaky": testStatusSucceeded, "test_broken": testStatusFailed, "test_ok": testStatusSkipped,
+	})
+	addTestRun(client, 3, "b", start, map[string]string{
+		"test_flaky": testStatusSucceeded, "test_broken": testStatusFailed, "test_ok": testStatusSucceeded,
+	})
+	// The run in progress is ignored
+	client.builds["e2e-tests-dev-pr:0004"] = types.Build{
+		Id:          aws.String("e2e-tests-dev-pr:0004"),
+		ProjectName: aws.String("e2e-tests-dev-pr"),
+		BuildStatus: types.StatusTypeInProgress,
+		StartTime:   aws.Time(start.Add(5 * time.Hour)),
+	}
+
+	histories, err := getTestHistories(context.Background(), client, "dev", 10)
+	require.NoError(t, err)
+	require.Len(t, histories, 3)
+
+	ranked := rankTestHistories(histories, false)
+	require.Len(t, ranked, 1)
+	flaky := ranked[0]
+	assert.Equal(t, "tests.wms.TestGetMap.test_flaky", flaky.Test)
+	assert.Equal(t, 4, flaky.Runs)
+	assert.Equal(t, 1, flaky.Failed)
+	assert.Equal(t, 2, flaky.Flips)
+	assert.InDelta(t, 0.75, flaky.PassRate, 0.001)
+	assert.InDelta(t, 2.5, flaky.AvgDuration, 0.001)
+	assert.Equal(t, []string{"a"}, flaky.Revisions)
+
+	ranked = rankTestHistories(histories, true)
+	require.Len(t, ranked, 2)
+	assert.Equal(t, "tests.wms.TestGetMap.test_broken", ranked[1].Test)
+	assert.False(t, ranked[1].Flaky)
+	assert.Equal(t, 0, ranked[1].Flips)
+
+	// Only the last 2 runs, the flaky test is not flaky on b
+	histories, err = getTestHistories(context.Background(), client, "dev", 2)
+	require.NoError(t, err)
+	assert.Empty(t, rankTestHistories(histories, false))
+
+	out := &bytes.Buffer{}
+	require.NoError(t, printTestHistories(out, ranked, outputFormatTable))
+	assert.Contains(t, out.String(), "dev     yes       4      3    75%      1      2      2.5s tests.wms.TestGetMap.test_flaky")
+}
@@ -9,6 +9,7 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/codebuild"
 	"github.com/geoadmin/tool-golang-bgdi/lib/fmtc"
@@ -22,6 +23,10 @@ type GetCmdFlags struct {
 	Detailed     bool
 	ShowProgress bool
 	Interval     int
+	Timeout      time.Duration
+	JUnitFile    string
+	JSONFile     string
+	Logs         logsOptions
 }
 
 //-----------------------------------------------------------------------------
@@ -63,9 +68,22 @@ Note that if the tests run is on-going, the command waits until its is finished.
 		if len(r.Builds) == 0 {
 			return fmt.Errorf("failed to get tests run %s: not found", flags.TestID)
 		}
+		// The timeout is shared by following the logs and waiting for the result
+		waitCtx, cancel := withWaitTimeout(ctx, flags.Timeout)
+		defer cancel()
+
+		if flags.Logs.Follow {
+			e = followBuildLogs(waitCtx, cmd, client, flags.TestID, flags.Logs, flags.Interval, 0)
+			if e != nil {
+				return e
+			}
+			// The logs replace the progress indicator
+			flags.ShowProgress = false
+		}
+
 		if !r.Builds[0].BuildComplete {
 			cPrintln(fmtc.NoColor, "E2E Tests run found, run in progress waiting to complete...")
-			r, e = waitForBuild(ctx, client, flags.TestID, flags.ShowProgress, flags.Interval)
+			r, e = waitForBuild(waitCtx, client, flags.TestID, flags.ShowProgress, flags.Interval, 0)
 			if e != nil {
 				return e
 			}
@@ -73,6 +91,11 @@ Note that if the tests run is on-going, the command waits until its is finished.
 			cPrintf(fmtc.NoColor, "E2E Tests run found and completed at %s\n", r.Builds[0].EndTime.UTC().String())
 		}
 
+		e = exportTestResult(ctx, client, r, flags.JUnitFile, flags.JSONFile)
+		if e != nil {
+			return e
+		}
+
 		return printTestResult(ctx, client, r, flags.Detailed)
 	},
 	ValidArgsFunction: func(_ *cobra.Command, _ []string, _ string) ([]cobra.Completion, cobra.ShellCompDirective) {
@@ -97,18 +120,31 @@ func getCmdGetFlags(cmd *cobra.Command) (GetCmdFlags, error) {
 	}
 	flags.ShowProgress = !np
 
-	interval, e := cmd.Flags().GetInt("interval")
+	interval, e := getIntervalFlag(cmd)
 	if e != nil {
 		return GetCmdFlags{}, e
 	}
 	flags.Interval = interval
 
+	timeout, e := cmd.Flags().GetDuration("timeout")
+	if e != nil {
+		return GetCmdFlags{}, e
+	}
+	flags.Timeout = timeout
+
 	detailed, e := cmd.Flags().GetBool("detailed")
 	if e != nil {
 		return GetCmdFlags{}, e
 	}
 	flags.Detailed = detailed
 
+	flags.JUnitFile, flags.JSONFile = getExportFlags(cmd)
+
+	flags.Logs, e = getLogsFlags(cmd)
+	if e != nil {
+		return GetCmdFlags{}, e
+	}
+
 	return flags, nil
 }
 
@@ -119,6 +155,8 @@ func init() {
 
 	getCmd.Flags().StringP("test-id", "t", "", "Test ID")
 	getCmd.Flags().BoolP("detailed", "d", false, "Show detailed test result")
+	addExportFlags(getCmd)
+	addLogsFlags(getCmd)
 	_ = getCmd.MarkFlagRequired("test-id")
 }
 
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/geoadmin/tool-golang-bgdi/lib/fmtc"
+)
+
+// Tests run started by the start command
+type startedRun struct {
+	Staging string
+	TestID  string
+}
+
+//-----------------------------------------------------------------------------
+
+// Writes the test IDs and log links of the started runs as key=value lines to the output
+// file (truncated) and to the $GITHUB_OUTPUT file (appended), so that the result can be
+// retrieved later with the get command.
+//
+// The keys are test_id_<staging>, log_link_<staging> and test_ids (comma separated), with a
+// single staging also test_id, log_link and staging.
+func writeHandoff(runs []startedRun, outputFile string, githubOutput bool) error {
+	if outputFile == "" && !githubOutput {
+		return nil
+	}
+	content := strings.Join(handoffLines(runs), "\n") + "\n"
+
+	if outputFile != "" {
+		e := os.WriteFile(outputFile, []byte(content), exportFileMode)
+		if e != nil {
+			return fmt.Errorf("failed to write output file %s: %w", outputFile, e)
+		}
+		cPrintf(fmtc.NoColor, "Test IDs written to %s\n", outputFile)
+	}
+	if githubOutput {
+		filename := os.Getenv("GITHUB_OUTPUT")
+		f, e := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, exportFileMode)
+		if e != nil {
+			return fmt.Errorf("failed to open GITHUB_OUTPUT file %s: %w", filename, e)
+		}
+		defer f.Close()
+		_, e = f.WriteString(content)
+		if e != nil {
+			return fmt.Errorf("failed to write GITHUB_OUTPUT file %s: %w", filename, e)
+		}
+	}
+	return nil
+}
+
+// Checks before starting the tests that the handoff files of writeHandoff can be written:
+// the directory of the output file exists and $GITHUB_OUTPUT is set and can be opened.
+func checkHandoff(outputFile string, githubOutput bool) error {
+	if outputFile != "" {
+		dir := filepath.Dir(outputFile)
+		info, e := os.Stat(dir)
+		if e != nil {
+			return fmt.Errorf("invalid --output-file %s: %w", outputFile, e)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("invalid --output-file %s: %s is not a directory", outputFile, dir)
+		}
+	}
+	if githubOutput {
+		filename := os.Getenv("GITHUB_OUTPUT")
+		if filename == "" {
+			return errors.New("--github-output requires the GITHUB_OUTPUT environment variable")
+		}
+		f, e := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, exportFileMode)
+		if e != nil {
+			return fmt.Errorf("failed to open GITHUB_OUTPUT file %s: %w", filename, e)
+		}
+		return f.Close()
+	}
+	return nil
+}
+
+func handoffLines(runs []startedRun) []string {
+	lines := []string{}
+	ids := []string{}
+	for _, run := range runs {
+		lines = append(lines,
+			fmt.Sprintf("test_id_%s=%s", run.Staging, run.TestID),
+			fmt.Sprintf("log_link_%s=%s", run.Staging, buildLogLink(run.TestID)),
+		)
+		ids = append(ids, run.TestID)
+	}
+	lines = append(lines, "test_ids="+strings.Join(ids, ","))
+	if len(runs) == 1 {
+		lines = append(lines,
+			"test_id="+runs[0].TestID,
+			"log_link="+buildLogLink(runs[0].TestID),
+			"staging="+runs[0].Staging,
+		)
+	}
+	return lines
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteHandoff(t *testing.T) {
+	dir := t.TempDir()
+	outputFile := filepath.Join(dir, "e2e-tests.env")
+	githubOutput := filepath.Join(dir, "github_output")
+	require.NoError(t, os.WriteFile(githubOutput, []byte("previous=1\n"), 0o600))
+	t.Setenv("GITHUB_OUTPUT", githubOutput)
+
+	runs := []startedRun{{Staging: "dev", TestID: "e2e-tests-dev-pr:1"}}
+	require.NoError(t, writeHandoff(runs, outputFile, true))
+
+	content, err := os.ReadFile(outputFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "test_id=e2e-tests-dev-pr:1\n")
+	assert.Contains(t, string(content), "log_link_dev=https://")
+	content, err = os.ReadFile(githubOutput)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "previous=1\ntest_id_dev=e2e-tests-dev-pr:1\n")
+
+}
+
+func TestCheckHandoff(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("GITHUB_OUTPUT", filepath.Join(dir, "github_output"))
+	require.NoError(t, checkHandoff(filepath.Join(dir, "e2e-tests.env"), true))
+	require.NoError(t, checkHandoff("", false))
+
+	assert.Error(t, checkHandoff(filepath.Join(dir, "missing", "e2e-tests.env"), false))
+	t.Setenv("GITHUB_OUTPUT", filepath.Join(dir, "missing", "github_output"))
+	assert.Error(t, checkHandoff("", true))
+	t.Setenv("GITHUB_OUTPUT", "")
+	assert.Error(t, checkHandoff("", true))
+}
+
+func TestRunStartStagingsNoWait(t *testing.T) {
+	client := newFakeCodeBuild()
+	outputFile := filepath.Join(t.TempDir(), "e2e-tests.env")
+	flags := StartCmdFlags{Stagings: []string{"dev", "int"}, NoWait: true, OutputFile: outputFile}
+
+	require.NoError(t, runStartStagings(context.Background(), func() {}, client, flags))
+	assert.Equal(t, 2, client.calls["StartBuild"])
+	assert.Equal(t, 0, client.calls["BatchGetBuilds"])
+
+	content, err := os.ReadFile(outputFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "test_ids=e2e-tests-dev-pr:1,e2e-tests-int-pr:2\n")
+	assert.NotContains(t, string(content), "test_id=")
+}
@@ -0,0 +1,343 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/codebuild"
+	"github.com/aws/aws-sdk-go-v2/service/codebuild/types"
+	"github.com/spf13/cobra"
+)
+
+// list and flaky output formats
+const (
+	outputFormatTable = "table"
+	outputFormatJSON  = "json"
+)
+
+//-----------------------------------------------------------------------------
+
+type ListCmdFlags struct {
+	Stagings []string
+	Status   string
+	Since    time.Time
+	Limit    int
+	Format   string
+	// Only the finished runs having test reports
+	finished bool
+}
+
+// Summary of an E2E tests run of the list command
+type testRunSummary struct {
+	ID        string    `json:"id"`
+	Staging   string    `json:"staging"`
+	Revision  string    `json:"revision"`
+	Tests     []string  `json:"tests"`
+	Initiator string    `json:"initiator"`
+	StartTime time.Time `json:"startTime"`
+	Duration  float64   `json:"durationSeconds"`
+	Status    string    `json:"status"`
+	// Resolved commit of the revision and test reports, used by the flaky command
+	commit     string
+	reportArns []string
+}
+
+//-----------------------------------------------------------------------------
+
+// listCmd represents the list command
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the recent E2E tests runs",
+	Long: `List the recent E2E tests runs of the stagings, newest first, with their test ID, staging,
+revision, tests, initiator, start time, duration and status.
+
+Examples:
+	e2e-tests list
+	e2e-tests list --staging int --status FAILED --since 48h
+	e2e-tests list --since 2025-05-01 --limit 100 --format json`,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		e := initPrint(cmd)
+		if e != nil {
+			return e
+		}
+		flags, e := getCmdListFlags(cmd, time.Now())
+		if e != nil {
+			return e
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop() // Ensure cleanup
+
+		client, e := getClient(ctx, cmd)
+		if e != nil {
+			return e
+		}
+
+		runs, e := listTestRuns(ctx, client, flags, time.Now())
+		if e != nil {
+			return e
+		}
+		return printTestRuns(cmd.OutOrStdout(), runs, flags.Format)
+	},
+	ValidArgsFunction: func(_ *cobra.Command, _ []string, _ string) ([]cobra.Completion, cobra.ShellCompDirective) {
+		// Avoid doing file/folder completion after the command
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	},
+}
+
+//-----------------------------------------------------------------------------
+
+func init() {
+	rootCmd.AddCommand(listCmd)
+
+	listCmd.Flags().StringSliceP("staging", "s", allStagings, "Stagings of the tests runs")
+	listCmd.Flags().String("status", "", "Only list the tests runs with this status (e.g. FAILED, SUCCEEDED)")
+	listCmd.Flags().String("since", "", "Only list the tests runs started since this duration (e.g. 24h) or date "+
+		"(2006-01-02)")
+	listCmd.Flags().IntP("limit", "n", 20, "Maximum number of tests runs to list, 0 for no limit") //nolint:mnd
+	listCmd.Flags().String("format", outputFormatTable, "Output format: table or json")
+
+	// Completions functions
+	_ = listCmd.RegisterFlagCompletionFunc(
+		"staging",
+		func(_ *cobra.Command, _ []string, _ string) ([]cobra.Completion, cobra.ShellCompDirective,
+		) {
+			return allStagings, cobra.ShellCompDirectiveNoFileComp
+		})
+	_ = listCmd.RegisterFlagCompletionFunc(
+		"status",
+		func(_ *cobra.Command, _ []string, _ string) ([]cobra.Completion, cobra.ShellCompDirective,
+		) {
+			completions := []cobra.Completion{}
+			for _, status := range types.StatusType("").Values() {
+				completions = append(completions, string(status))
+			}
+			return completions, cobra.ShellCompDirectiveNoFileComp
+		})
+	_ = listCmd.RegisterFlagCompletionFunc(
+		"format",
+		func(_ *cobra.Command, _ []string, _ string) ([]cobra.Completion, cobra.ShellCompDirective,
+		) {
+			return []cobra.Completion{outputFormatTable, outputFormatJSON}, cobra.ShellCompDirectiveNoFileComp
+		})
+}
+
+//-----------------------------------------------------------------------------
+
+// Get list command flags, the --since duration is relative to now
+func getCmdListFlags(cmd *cobra.Command, now time.Time) (ListCmdFlags, error) {
+	var flags ListCmdFlags
+	stagings, e := cmd.Flags().GetStringSlice("staging")
+	if e != nil {
+		return ListCmdFlags{}, e
+	}
+	flags.Stagings = stagings
+
+	flags.Status = strings.ToUpper(cmd.Flag("status").Value.String())
+	if flags.Status != "" && !slices.Contains(types.StatusType("").Values(), types.StatusType(flags.Status)) {
+		return ListCmdFlags{}, fmt.Errorf("invalid --status %s", flags.Status)
+	}
+
+	flags.Since, e = parseSince(cmd.Flag("since").Value.String(), now)
+	if e != nil {
+		return ListCmdFlags{}, e
+	}
+
+	flags.Limit, e = cmd.Flags().GetInt("limit")
+	if e != nil {
+		return ListCmdFlags{}, e
+	}
+	if flags.Limit < 0 {
+		return ListCmdFlags{}, fmt.Errorf("invalid --limit %d, must be >= 0", flags.Limit)
+	}
+
+	flags.Format = cmd.Flag("format").Value.String()
+	if flags.Format != outputFormatTable && flags.Format != outputFormatJSON {
+		return ListCmdFlags{}, fmt.Errorf("invalid --format %s, must be %s or %s",
+			flags.Format, outputFormatTable, outputFormatJSON)
+	}
+
+	return flags, nil
+}
+
+// Parses --since as a duration before now or a date, an empty string returns the zero time
+func parseSince(since string, now time.Time) (time.Time, error) {
+	if since == "" {
+		return time.Time{}, nil
+	}
+	d, e := time.ParseDuration(since)
+	if e == nil {
+		return now.Add(-d), nil
+	}
+	t, e := time.ParseInLocation(time.DateOnly, since, time.Local)
+	if e != nil {
+		return time.Time{}, fmt.Errorf("invalid --since %s, must be a duration or a date (2006-01-02)", since)
+	}
+	return t, nil
+}
+
+//-----------------------------------------------------------------------------
+
+// Returns the tests runs of all stagings matching the flags, newest first
+func listTestRuns(
+	ctx context.Context,
+	client codebuildAPI,
+	flags ListCmdFlags,
+	now time.Time,
+) ([]testRunSummary, error) {
+	runs := []testRunSummary{}
+	for _, staging := range flags.Stagings {
+		r, e := listProjectTestRuns(ctx, client, projectName(staging), flags, now)
+		if e != nil {
+			return nil, e
+		}
+		runs = append(runs, r...)
+	}
+
+	slices.SortStableFunc(runs, func(a, b testRunSummary) int {
+		return b.StartTime.Compare(a.StartTime)
+	})
+	if flags.Limit > 0 && len(runs) > flags.Limit {
+		runs = runs[:flags.Limit]
+	}
+	return runs, nil
+}
+
+// Returns the tests runs of the project matching the flags, newest first. The builds
+// are listed newest first, so the listing stops at the first build older than --since
+// or when --limit builds are found.
+func listProjectTestRuns(
+	ctx context.Context,
+	client codebuildAPI,
+	project string,
+	flags ListCmdFlags,
+	now time.Time,
+) ([]testRunSummary, error) {
+	runs := []testRunSummary{}
+	paginator := codebuild.NewListBuildsForProjectPaginator(client, &codebuild.ListBuildsForProjectInput{
+		ProjectName: &project,
+		SortOrder:   types.SortOrderTypeDescending,
+	})
+	for paginator.HasMorePages() {
+		page, e := paginator.NextPage(ctx)
+		if e != nil {
+			return nil, fmt.Errorf("failed to list the tests runs of %s: %w", project, e)
+		}
+
+		for chunk := range slices.Chunk(page.Ids, maxBatchGetBuilds) {
+			r, err := client.BatchGetBuilds(ctx, &codebuild.BatchGetBuildsInput{Ids: chunk})
+			if err != nil {
+				return nil, fmt.Errorf("failed to get tests runs %s: %w", strings.Join(chunk, ", "), err)
+			}
+			builds := r.Builds
+			slices.SortStableFunc(builds, func(a, b types.Build) int {
+				return aws.ToTime(b.StartTime).Compare(aws.ToTime(a.StartTime))
+			})
+
+			for _, build := range builds {
+				run := newTestRunSummary(build, now)
+				if run.StartTime.Before(flags.Since) {
+					return runs, nil
+				}
+				if flags.Status != "" && run.Status != flags.Status {
+					continue
+				}
+				if flags.finished && (run.Status == string(types.StatusTypeInProgress) || len(run.reportArns) == 0) {
+					continue
+				}
+				runs = append(runs, run)
+				if flags.Limit > 0 && len(runs) >= flags.Limit {
+					return runs, nil
+				}
+			}
+		}
+	}
+	return runs, nil
+}
+
+func newTestRunSummary(build types.Build, now time.Time) testRunSummary {
+	run := testRunSummary{
+		ID:         aws.ToString(build.Id),
+		Staging:    stagingFromProjectName(aws.ToString(build.ProjectName)),
+		Revision:   aws.ToString(build.SourceVersion),
+		Tests:      []string{},
+		Initiator:  aws.ToString(build.Initiator),
+		StartTime:  aws.ToTime(build.StartTime),
+		Status:     string(build.BuildStatus),
+		commit:     aws.ToString(build.ResolvedSourceVersion),
+		reportArns: build.ReportArns,
+	}
+	if run.commit == "" {
+		run.commit = run.Revision
+	}
+
+	end := now
+	if build.EndTime != nil {
+		end = *build.EndTime
+	}
+	if !run.StartTime.IsZero() {
+		run.Duration = end.Sub(run.StartTime).Round(time.Second).Seconds()
+	}
+
+	if build.Environment != nil {
+		for _, v := range build.Environment.EnvironmentVariables {
+			if aws.ToString(v.Name) != "TEST_NAMES" || aws.ToString(v.Value) == "" {
+				continue
+			}
+			for _, t := range strings.Split(aws.ToString(v.Value), ",") {
+				run.Tests = append(run.Tests, strings.TrimPrefix(t, "tests."))
+			}
+		}
+	}
+	return run
+}
+
+//-----------------------------------------------------------------------------
+
+func printTestRuns(writer io.Writer, runs []testRunSummary, format string) error {
+	if format == outputFormatJSON {
+		d, e := json.MarshalIndent(runs, "", "  ")
+		if e != nil {
+			return e
+		}
+		_, e = fmt.Fprintln(writer, string(d))
+		return e
+	}
+
+	_, e := fmt.Fprintf(writer, "%-56s %-7s %-12s %-20s %9s %-20s %-32s %s\n",
+		"ID", "STAGING", "STATUS", "START", "DURATION", "REVISION", "INITIATOR", "TESTS")
+	if e != nil {
+		return e
+	}
+	for _, run := range runs {
+		tests := "all"
+		if len(run.Tests) > 0 {
+			tests = strings.Join(run.Tests, ",")
+		}
+		_, e = fmt.Fprintf(writer, "%-56s %-7s %-12s %-20s %9s %-20s %-32s %s\n",
+			run.ID,
+			run.Staging,
+			run.Status,
+			run.StartTime.Local().Format(time.DateTime),
+			time.Duration(run.Duration)*time.Second,
+			run.Revision,
+			run.Initiator,
+			tests,
+		)
+		if e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/codebuild/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Adds count builds of the staging started every hour before now
+func addHourlyBuilds(client *fakeCodeBuild, staging string, count int, now time.Time) {
+	for i := range count {
+		id := fmt.Sprintf("%s:%04d", projectName(staging), i)
+		status := types.StatusTypeSucceeded
+		if i%2 == 0 {
+			status = types.StatusTypeFailed
+		}
+		client.builds[id] = types.Build{
+			Id:            aws.String(id),
+			ProjectName:   aws.String(projectName(staging)),
+			BuildStatus:   status,
+			BuildComplete: true,
+			StartTime:     aws.Time(now.Add(-time.Duration(i+1) * time.Hour)),
+			EndTime:       aws.Time(now.Add(-time.Duration(i+1)*time.Hour + 10*time.Minute)),
+		}
+	}
+}
+
+func TestListTestRuns(t *testing.T) {
+	now := time.Date(2025, 5, 10, 12, 0, 0, 0, time.UTC)
+	client := newFakeCodeBuild()
+	addHourlyBuilds(client, "dev", 250, now)
+	addHourlyBuilds(client, "int", 5, now)
+
+	flags := ListCmdFlags{Stagings: allStagings}
+	runs, err := listTestRuns(context.Background(), client, flags, now)
+	require.NoError(t, err)
+	assert.Len(t, runs, 255)
+	assert.Equal(t, "e2e-tests-dev-pr:0000", runs[0].ID)
+	assert.Equal(t, "int", runs[1].Staging)
+	assert.Equal(t, "e2e-tests-dev-pr:0249", runs[254].ID)
+	// 3 pages of dev, 1 page of int and prod
+	assert.Equal(t, 5, client.calls["ListBuildsForProject"])
+
+	// The listing stops at the limit and since
+	client.calls = map[string]int{}
+	flags = ListCmdFlags{Stagings: []string{"dev"}, Limit: 3, Status: string(types.StatusTypeFailed)}
+	runs, err = listTestRuns(context.Background(), client, flags, now)
+	require.NoError(t, err)
+	require.Len(t, runs, 3)
+	assert.Equal(t, "e2e-tests-dev-pr:0004", runs[2].ID)
+	assert.Equal(t, 1, client.calls["BatchGetBuilds"])
+
+	flags = ListCmdFlags{Stagings: []string{"dev", "int"}, Since: now.Add(-150 * time.Minute)}
+	runs, err = listTestRuns(context.Background(), client, flags, now)
+	require.NoError(t, err)
+	assert.Len(t, runs, 4)
+
+	out := &bytes.Buffer{}
+	require.NoError(t, printTestRuns(out, runs[:1], outputFormatJSON))
+	decoded := []testRunSummary{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+	assert.Equal(t, runs[:1], decoded)
+}
+
+func TestNewTestRunSummary(t *testing.T) {
+	now := time.Date(2025, 5, 10, 12, 0, 0, 0, time.UTC)
+	build := types.Build{
+		Id:            aws.String("e2e-tests-int-pr:1"),
+		ProjectName:   aws.String("e2e-tests-int-pr"),
+		SourceVersion: aws.String("master"),
+		Initiator:     aws.String("jenkins"),
+		BuildStatus:   types.StatusTypeInProgress,
+		StartTime:     aws.Time(now.Add(-90 * time.Second)),
+		Environment: &types.ProjectEnvironment{EnvironmentVariables: []types.EnvironmentVariable{
+			{Name: aws.String("DO_DATA_TEST"), Value: aws.String("0")},
+			{Name: aws.String("TEST_NAMES"), Value: aws.String("tests.api,tests.wms.test_getmap")},
+		}},
+	}
+	run := newTestRunSummary(build, now)
+	assert.Equal(t, "int", run.Staging)
+	assert.Equal(t, []string{"api", "wms.test_getmap"}, run.Tests)
+	assert.InDelta(t, 90.0, run.Duration, 0)
+
+	since, err := parseSince("24h", now)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(-24*time.Hour), since)
+	_, err = parseSince("yesterday", now)
+	assert.Error(t, err)
+}
@@ -0,0 +1,296 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/aws/aws-sdk-go-v2/service/codebuild"
+	"github.com/aws/aws-sdk-go-v2/service/codebuild/types"
+	"github.com/spf13/cobra"
+)
+
+//-----------------------------------------------------------------------------
+
+// CloudWatch Logs API used to read the build logs, implemented by *cloudwatchlogs.Client
+type cloudwatchLogsAPI interface {
+	GetLogEvents(ctx context.Context, params *cloudwatchlogs.GetLogEventsInput, optFns ...func(*cloudwatchlogs.Options)) (
+		*cloudwatchlogs.GetLogEventsOutput, error)
+}
+
+// Options of the build logs output
+type logsOptions struct {
+	Follow  bool
+	Filter  *regexp.Regexp
+	LogFile string
+}
+
+//-----------------------------------------------------------------------------
+
+// logsCmd represents the logs command
+var logsCmd = &cobra.Command{
+	Use:   "logs",
+	Short: "Print the logs of an E2E tests run",
+	Long: `Print the CloudWatch logs of an E2E tests run.
+
+With --follow the logs are streamed until the tests run is finished or --timeout is reached.
+
+Examples:
+	e2e-tests logs --test-id e2e-tests-dev-pr:1234 --follow
+	e2e-tests logs --test-id e2e-tests-dev-pr:1234 --log-filter 'FAILED|ERROR' --log-file e2e-tests.log`,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		e := initPrint(cmd)
+		if e != nil {
+			return e
+		}
+
+		testID := cmd.Flag("test-id").Value.String()
+		opts, e := getLogsFlags(cmd)
+		if e != nil {
+			return e
+		}
+		interval, e := getIntervalFlag(cmd)
+		if e != nil {
+			return e
+		}
+		timeout, e := cmd.Flags().GetDuration("timeout")
+		if e != nil {
+			return e
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop() // Ensure cleanup
+
+		client, e := getClient(ctx, cmd)
+		if e != nil {
+			return e
+		}
+		logsClient, e := getLogsClient(ctx, cmd)
+		if e != nil {
+			return e
+		}
+
+		return printBuildLogs(ctx, client, logsClient, testID, opts, interval, timeout)
+	},
+	ValidArgsFunction: func(_ *cobra.Command, _ []string, _ string) ([]cobra.Completion, cobra.ShellCompDirective) {
+		// Avoid doing file/folder completion after the command
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	},
+}
+
+//-----------------------------------------------------------------------------
+
+func init() {
+	rootCmd.AddCommand(logsCmd)
+
+	logsCmd.Flags().StringP("test-id", "t", "", "Test ID")
+	addLogsFlags(logsCmd)
+	_ = logsCmd.MarkFlagRequired("test-id")
+}
+
+//-----------------------------------------------------------------------------
+
+// Adds the flags used by getLogsFlags to the command
+func addLogsFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolP("follow", "f", false, "Stream the build logs until the tests run is finished")
+	cmd.Flags().String("log-filter", "", "Only print the log lines matching this regular expression")
+	cmd.Flags().String("log-file", "", "Also write the (filtered) log lines to this file")
+}
+
+func getLogsFlags(cmd *cobra.Command) (logsOptions, error) {
+	var opts logsOptions
+	follow, e := cmd.Flags().GetBool("follow")
+	if e != nil {
+		return opts, e
+	}
+	opts.Follow = follow
+
+	if filter := cmd.Flag("log-filter").Value.String(); filter != "" {
+		opts.Filter, e = regexp.Compile(filter)
+		if e != nil {
+			return opts, fmt.Errorf("invalid --log-filter %q: %w", filter, e)
+		}
+	}
+	opts.LogFile = cmd.Flag("log-file").Value.String()
+
+	return opts, nil
+}
+
+//-----------------------------------------------------------------------------
+
+// Prints the logs of the build, if opts.Follow is set the logs are streamed until
+// the build is complete or the timeout (0 for none) is reached. The build is polled
+// with the same backoff as waitForBuilds.
+func printBuildLogs(
+	ctx context.Context,
+	client codebuildAPI,
+	logsClient cloudwatchLogsAPI,
+	buildID string,
+	opts logsOptions,
+	interval int,
+	timeout time.Duration,
+) error {
+	ctx, cancel := withWaitTimeout(ctx, timeout)
+	defer cancel()
+
+	var out io.Writer = os.Stdout
+	if opts.LogFile != "" {
+		f, e := os.OpenFile(opts.LogFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, exportFileMode)
+		if e != nil {
+			return fmt.Errorf("failed to open log file %s: %w", opts.LogFile, e)
+		}
+		defer f.Close()
+		out = io.MultiWriter(os.Stdout, f)
+	}
+
+	tailer := &logTailer{client: logsClient, filter: opts.Filter, out: out}
+	delay := time.Duration(interval) * time.Second
+	maxDelay := max(delay, maxPollInterval)
+	pollErrors := pollRetry{}
+	for {
+		done, e := tailer.tailBuild(ctx, client, buildID, opts.Follow)
+		if e != nil {
+			if ctx.Err() != nil {
+				return context.Cause(ctx)
+			}
+			// The tailer keeps its position, the logs are not printed twice on retry
+			if !pollErrors.retry(e) {
+				return e
+			}
+		} else {
+			if done {
+				return nil
+			}
+			pollErrors.reset()
+		}
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case <-time.After(delay):
+		}
+		delay = min(delay+delay/2, maxDelay) //nolint:mnd
+	}
+}
+
+// Prints the new logs of the build, returns true when all the logs are printed: without
+// follow or when the build is complete
+func (t *logTailer) tailBuild(ctx context.Context, client codebuildAPI, buildID string, follow bool) (bool, error) {
+	build, e := getBuild(ctx, client, buildID)
+	if e != nil {
+		return false, e
+	}
+
+	group, stream, ok := buildLogStream(build)
+	if ok {
+		e = t.tail(ctx, group, stream)
+		if e != nil {
+			return false, e
+		}
+	} else if !follow || build.BuildComplete {
+		return false, fmt.Errorf("no CloudWatch logs found for tests run %s", buildID)
+	}
+	return !follow || build.BuildComplete, nil
+}
+
+// Streams the logs of the build with a new CloudWatch Logs client until the build is complete
+func followBuildLogs(
+	ctx context.Context,
+	cmd *cobra.Command,
+	client codebuildAPI,
+	buildID string,
+	opts logsOptions,
+	interval int,
+	timeout time.Duration,
+) error {
+	logsClient, e := getLogsClient(ctx, cmd)
+	if e != nil {
+		return e
+	}
+	return printBuildLogs(ctx, client, logsClient, buildID, opts, interval, timeout)
+}
+
+func getBuild(ctx context.Context, client codebuildAPI, buildID string) (types.Build, error) {
+	r, e := client.BatchGetBuilds(ctx, &codebuild.BatchGetBuildsInput{Ids: []string{buildID}})
+	if e != nil {
+		return types.Build{}, fmt.Errorf("failed to get tests run %s: %w", buildID, e)
+	}
+	if len(r.Builds) == 0 {
+		return types.Build{}, fmt.Errorf("failed to get tests run %s: not found", buildID)
+	}
+	return r.Builds[0], nil
+}
+
+// Returns the CloudWatch log group and stream of the build, they are only known once
+// the build is provisioned.
+func buildLogStream(build types.Build) (string, string, bool) {
+	if build.Logs == nil || build.Logs.GroupName == nil || build.Logs.StreamName == nil {
+		return "", "", false
+	}
+	return *build.Logs.GroupName, *build.Logs.StreamName, true
+}
+
+//-----------------------------------------------------------------------------
+
+// logTailer prints the new events of a log stream on each tail call
+type logTailer struct {
+	client cloudwatchLogsAPI
+	filter *regexp.Regexp
+	out    io.Writer
+	// Forward token of the last events read
+	token *string
+}
+
+// Prints all the events since the last call
+func (t *logTailer) tail(ctx context.Context, group, stream string) error {
+	for {
+		r, e := t.client.GetLogEvents(ctx, &cloudwatchlogs.GetLogEventsInput{
+			LogGroupName:  &group,
+			LogStreamName: &stream,
+			StartFromHead: aws.Bool(true),
+			NextToken:     t.token,
+		})
+		if e != nil {
+			var notFound *cwtypes.ResourceNotFoundException
+			if errors.As(e, &notFound) {
+				// The log stream is created when the build starts writing logs
+				return nil
+			}
+			return fmt.Errorf("failed to get log events of %s/%s: %w", group, stream, e)
+		}
+
+		for _, event := range r.Events {
+			e = t.print(aws.ToString(event.Message))
+			if e != nil {
+				return e
+			}
+		}
+
+		// The same token is returned when reaching the end of the stream
+		last := t.token
+		t.token = r.NextForwardToken
+		if r.NextForwardToken == nil || (last != nil && *last == *r.NextForwardToken) {
+			return nil
+		}
+	}
+}
+
+func (t *logTailer) print(message string) error {
+	line := strings.TrimRight(message, "\r\n")
+	if t.filter != nil && !t.filter.MatchString(line) {
+		return nil
+	}
+	_, e := fmt.Fprintln(t.out, line)
+	return e
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/aws/aws-sdk-go-v2/service/codebuild/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLogs is an in memory log stream returning pageSize events per call
+type fakeLogs struct {
+	messages []string
+	pageSize int
+	// Stream not yet created
+	notFound bool
+}
+
+func (f *fakeLogs) GetLogEvents(
+	_ context.Context, params *cloudwatchlogs.GetLogEventsInput, _ ...func(*cloudwatchlogs.Options),
+) (*cloudwatchlogs.GetLogEventsOutput, error) {
+	if f.notFound {
+		return nil, &cwtypes.ResourceNotFoundException{Message: aws.String("stream not found")}
+	}
+	start := 0
+	if params.NextToken != nil {
+		var err error
+		start, err = strconv.Atoi(*params.NextToken)
+		if err != nil {
+			return nil, err
+		}
+	}
+	end := min(start+f.pageSize, len(f.messages))
+	output := &cloudwatchlogs.GetLogEventsOutput{NextForwardToken: aws.String(strconv.Itoa(end))}
+	for _, message := range f.messages[start:end] {
+		output.Events = append(output.Events, cwtypes.OutputLogEvent{Message: aws.String(message + "\n")})
+	}
+	return output, nil
+}
+
+//-----------------------------------------------------------------------------
+
+func TestLogTailer(t *testing.T) {
+	logs := &fakeLogs{pageSize: 2, notFound: true}
+	out := &bytes.Buffer{}
+	tailer := &logTailer{client: logs, filter: regexp.MustCompile("^tests"), out: out}
+
+	// The stream doesn't exist yet
+	require.NoError(t, tailer.tail(context.Background(), "group", "stream"))
+	assert.Empty(t, out.String())
+
+	logs.notFound = false
+	logs.messages = []string{"setup", "tests.a ok", "tests.b ok", "tests.c FAILED", "cleanup"}
+	require.NoError(t, tailer.tail(context.Background(), "group", "stream"))
+	assert.Equal(t, "tests.a ok\ntests.b ok\ntests.c FAILED\n", out.String())
+
+	// Only the new events are printed
+	out.Reset()
+	logs.messages = append(logs.messages, "tests.d ok")
+	require.NoError(t, tailer.tail(context.Background(), "group", "stream"))
+	assert.Equal(t, "tests.d ok\n", out.String())
+}
+
+func TestPrintBuildLogs(t *testing.T) {
+	client := newFakeCodeBuild()
+	client.builds["e2e-tests-dev-pr:1"] = types.Build{
+		Id:            aws.String("e2e-tests-dev-pr:1"),
+		BuildComplete: true,
+		Logs: &types.LogsLocation{
+			GroupName:  aws.String("/aws/codebuild/e2e-tests-dev-pr"),
+			StreamName: aws.String("1"),
+		},
+	}
+	client.builds["e2e-tests-dev-pr:2"] = types.Build{Id: aws.String("e2e-tests-dev-pr:2"), BuildComplete: true}
+	logs := &fakeLogs{pageSize: 100, messages: []string{"line 1", "line 2"}}
+	logFile := filepath.Join(t.TempDir(), "build.log")
+
+	opts := logsOptions{Follow: true, LogFile: logFile}
+	require.NoError(t, printBuildLogs(context.Background(), client, logs, "e2e-tests-dev-pr:1", opts, 1, 0))
+	content, err := os.ReadFile(logFile)
+	require.NoError(t, err)
+	assert.Equal(t, "line 1\nline 2\n", string(content))
+
+	err = printBuildLogs(context.Background(), client, logs, "e2e-tests-dev-pr:2", logsOptions{}, 1, 0)
+	require.ErrorContains(t, err, "no CloudWatch logs found")
+
+	// Following a run in progress stops at the timeout
+	client.builds["e2e-tests-dev-pr:3"] = types.Build{Id: aws.String("e2e-tests-dev-pr:3")}
+	opts = logsOptions{Follow: true}
+	err = printBuildLogs(context.Background(), client, logs, "e2e-tests-dev-pr:3", opts, 1, 10*time.Millisecond)
+	require.ErrorIs(t, err, errWaitTimeout)
+}
+
+func TestPrintBuildLogsRetries(t *testing.T) {
+	fake := newFakeCodeBuild()
+	fake.builds["e2e-tests-dev-pr:1"] = types.Build{
+		Id:            aws.String("e2e-tests-dev-pr:1"),
+		BuildComplete: true,
+		Logs: &types.LogsLocation{
+			GroupName:  aws.String("/aws/codebuild/e2e-tests-dev-pr"),
+			StreamName: aws.String("1"),
+		},
+	}
+	throttling := &smithy.GenericAPIError{Code: "ThrottlingException", Message: "Rate exceeded"}
+	client := &failingCodeBuild{fakeCodeBuild: fake, errs: []error{throttling, throttling}}
+	logs := &fakeLogs{pageSize: 100, messages: []string{"line 1"}}
+	logFile := filepath.Join(t.TempDir(), "build.log")
+
+	opts := logsOptions{Follow: true, LogFile: logFile}
+	require.NoError(t, printBuildLogs(context.Background(), client, logs, "e2e-tests-dev-pr:1", opts, 0, 0))
+	content, err := os.ReadFile(logFile)
+	require.NoError(t, err)
+	assert.Equal(t, "line 1\n", string(content))
+
+	// Other errors are not retried
+	denied := &smithy.GenericAPIError{Code: "AccessDeniedException"}
+	client.errs = []error{denied}
+	err = printBuildLogs(context.Background(), client, logs, "e2e-tests-dev-pr:1", opts, 0, 0)
+	require.ErrorAs(t, err, &denied)
+}
+
+func TestWithWaitTimeout(t *testing.T) {
+	ctx, cancel := withWaitTimeout(context.Background(), 0)
+	defer cancel()
+	_, ok := ctx.Deadline()
+	assert.False(t, ok)
+
+	// The deadline is shared by the calls using the context
+	ctx, cancel = withWaitTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	require.ErrorIs(t, context.Cause(ctx), errWaitTimeout)
+	_, err := waitForBuilds(ctx, newFakeCodeBuild(), []string{"e2e-tests-dev-pr:1"}, false, 1, 0)
+	require.ErrorIs(t, err, errWaitTimeout)
+}
@@ -0,0 +1,275 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/codebuild"
+	"github.com/aws/aws-sdk-go-v2/service/codebuild/types"
+	"github.com/geoadmin/tool-golang-bgdi/e2e-tests/cmd/completions"
+	"github.com/geoadmin/tool-golang-bgdi/lib/fmtc"
+	"github.com/spf13/cobra"
+)
+
+//-----------------------------------------------------------------------------
+
+type RetryCmdFlags struct {
+	TestID       string
+	Repeat       int
+	ShowProgress bool
+	Interval     int
+	Timeout      time.Duration
+	JUnitFile    string
+	JSONFile     string
+}
+
+//-----------------------------------------------------------------------------
+
+// retryCmd represents the retry command
+var retryCmd = &cobra.Command{
+	Use:   "retry",
+	Short: "Rerun the failed tests of an E2E tests run",
+	Long: `Rerun only the failed and errored tests of a finished E2E tests run, with the same staging,
+revision and data tests setting.
+
+The failed test cases are mapped to the test modules of the E2E tests repository (as for the
+--tests completion of start). With --repeat the failed tests of each new run are retried until
+all tests succeed or the number of retries is reached.
+
+Examples:
+	e2e-tests retry --test-id e2e-tests-dev-pr:1234
+	e2e-tests retry --test-id e2e-tests-dev-pr:1234 --repeat 3`,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		e := initPrint(cmd)
+		if e != nil {
+			return e
+		}
+		flags, e := getCmdRetryFlags(cmd)
+		if e != nil {
+			return e
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop() // Ensure cleanup
+
+		client, e := getClient(ctx, cmd)
+		if e != nil {
+			return e
+		}
+
+		modules, e := completions.TestModules()
+		if e != nil {
+			cPrintf(fmtc.Yellow, "Failed to get the test modules, using the test prefixes: %s\n", e)
+		}
+
+		return runRetry(ctx, client, flags, modules)
+	},
+	ValidArgsFunction: func(_ *cobra.Command, _ []string, _ string) ([]cobra.Completion, cobra.ShellCompDirective) {
+		// Avoid doing file/folder completion after the command
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	},
+}
+
+//-----------------------------------------------------------------------------
+
+func init() {
+	rootCmd.AddCommand(retryCmd)
+
+	retryCmd.Flags().StringP("test-id", "t", "", "Test ID of the run to retry")
+	retryCmd.Flags().IntP("repeat", "r", 1, "Maximum number of retries while tests fail")
+	addExportFlags(retryCmd)
+	_ = retryCmd.MarkFlagRequired("test-id")
+}
+
+//-----------------------------------------------------------------------------
+
+func getCmdRetryFlags(cmd *cobra.Command) (RetryCmdFlags, error) {
+	var flags RetryCmdFlags
+	flags.TestID = cmd.Flag("test-id").Value.String()
+
+	repeat, e := cmd.Flags().GetInt("repeat")
+	if e != nil {
+		return RetryCmdFlags{}, e
+	}
+	if repeat < 1 {
+		return RetryCmdFlags{}, fmt.Errorf("invalid --repeat %d, must be >= 1", repeat)
+	}
+	flags.Repeat = repeat
+
+	np, e := cmd.Flags().GetBool("no-progress")
+	if e != nil {
+		return RetryCmdFlags{}, e
+	}
+	flags.ShowProgress = !np
+
+	interval, e := getIntervalFlag(cmd)
+	if e != nil {
+		return RetryCmdFlags{}, e
+	}
+	flags.Interval = interval
+
+	timeout, e := cmd.Flags().GetDuration("timeout")
+	if e != nil {
+		return RetryCmdFlags{}, e
+	}
+	flags.Timeout = timeout
+
+	flags.JUnitFile, flags.JSONFile = getExportFlags(cmd)
+
+	return flags, nil
+}
+
+//-----------------------------------------------------------------------------
+
+// Reruns the failed tests of the run until they succeed or flags.Repeat retries are done,
+// the result of the last retry is printed.
+func runRetry(ctx context.Context, client codebuildAPI, flags RetryCmdFlags, modules []string) error {
+	build, e := getBuild(ctx, client, flags.TestID)
+	if e != nil {
+		return e
+	}
+	if !build.BuildComplete {
+		return fmt.Errorf("tests run %s is still in progress", flags.TestID)
+	}
+	if build.BuildStatus == types.StatusTypeSucceeded {
+		cPrintf(fmtc.Green, "E2E tests run %s succeeded, nothing to retry\n", flags.TestID)
+		return nil
+	}
+
+	var result *codebuild.BatchGetBuildsOutput
+	for retry := 1; retry <= flags.Repeat; retry++ {
+		startFlags, err := retryStartFlags(ctx, client, build, modules)
+		if err != nil {
+			return err
+		}
+		startFlags.ShowProgress = flags.ShowProgress
+		startFlags.Interval = flags.Interval
+
+		cPrintf(fmtc.NoColor, "Retry %d/%d of %s: ", retry, flags.Repeat, aws.ToString(build.Id))
+		printStart(startFlags.Staging, startFlags.Tests)
+		rs, err := startBuild(ctx, client, startFlags)
+		if err != nil {
+			return err
+		}
+		result, err = waitForBuild(ctx, client, *rs.Build.Id, flags.ShowProgress, flags.Interval, flags.Timeout)
+		if err != nil {
+			return err
+		}
+
+		build = result.Builds[0]
+		if build.BuildStatus == types.StatusTypeSucceeded {
+			break
+		}
+	}
+
+	e = exportTestResult(ctx, client, result, flags.JUnitFile, flags.JSONFile)
+	if e != nil {
+		return e
+	}
+	return printTestResult(ctx, client, result, false)
+}
+
+// Returns the start flags rerunning the failed tests of the build with the same staging,
+// revision and data tests setting
+func retryStartFlags(
+	ctx context.Context,
+	client codebuildAPI,
+	build types.Build,
+	modules []string,
+) (StartCmdFlags, error) {
+	buildID := aws.ToString(build.Id)
+	flags := StartCmdFlags{
+		Staging:  stagingFromProjectName(projectNameFromBuildID(buildID)),
+		Revision: aws.ToString(build.SourceVersion),
+	}
+	// Rerun the same commit, the source version can be a branch
+	if build.ResolvedSourceVersion != nil {
+		flags.Revision = *build.ResolvedSourceVersion
+	}
+	if build.Environment != nil {
+		for _, v := range build.Environment.EnvironmentVariables {
+			if aws.ToString(v.Name) == "DO_DATA_TEST" {
+				flags.DoDataTest = aws.ToString(v.Value) == "1"
+			}
+		}
+	}
+
+	failed, e := getFailedTestCases(ctx, client, build)
+	if e != nil {
+		return flags, e
+	}
+	if len(failed) == 0 {
+		return flags, fmt.Errorf("no failed tests found in tests run %s, use start to rerun all tests", buildID)
+	}
+	for _, module := range failedTestModules(failed, modules) {
+		flags.Tests = append(flags.Tests, "tests."+module)
+	}
+	return flags, nil
+}
+
+// Returns the failed and errored test cases of all the reports of the build
+func getFailedTestCases(ctx context.Context, client codebuildAPI, build types.Build) ([]types.TestCase, error) {
+	failed := []types.TestCase{}
+	if len(build.ReportArns) == 0 {
+		return failed, nil
+	}
+	reports, e := getReports(ctx, client, build.ReportArns)
+	if e != nil {
+		return nil, e
+	}
+	for _, report := range reports {
+		for _, status := range []string{testStatusFailed, testStatusError} {
+			tests, err := describeTestCases(ctx, client, aws.ToString(report.Arn), &types.TestCaseFilter{Status: &status})
+			if err != nil {
+				return nil, fmt.Errorf("failed to describe test case %s for reportARN=%s: %w",
+					status, aws.ToString(report.Arn), err)
+			}
+			failed = append(failed, tests...)
+		}
+	}
+	return failed, nil
+}
+
+// Returns the sorted test modules (without "tests." prefix) of the test cases. A test case
+// prefix (e.g. tests.wms.test_getmap.TestGetMap) is mapped to the longest matching module,
+// without modules (e.g. the E2E tests repository is not available) to the prefix up to its
+// last test_* component.
+func failedTestModules(tests []types.TestCase, modules []string) []string {
+	failed := []string{}
+	for _, t := range tests {
+		prefix := strings.TrimPrefix(aws.ToString(t.Prefix), "tests.")
+		module := ""
+		for _, m := range modules {
+			if (prefix == m || strings.HasPrefix(prefix, m+".")) && len(m) > len(module) {
+				module = m
+			}
+		}
+		if module == "" {
+			module = testModuleFromPrefix(prefix)
+		}
+		if !slices.Contains(failed, module) {
+			failed = append(failed, module)
+		}
+	}
+	slices.Sort(failed)
+	return failed
+}
+
+func testModuleFromPrefix(prefix string) string {
+	parts := strings.Split(prefix, ".")
+	for i := len(parts) - 1; i > 0; i-- {
+		if strings.HasPrefix(parts[i], "test_") {
+			return strings.Join(parts[:i+1], ".")
+		}
+	}
+	return prefix
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/codebuild/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFailedTestModules(t *testing.T) {
+	tests := []types.TestCase{
+		{Prefix: aws.String("tests.wms.test_getmap.TestGetMap")},
+		{Prefix: aws.String("tests.wms.test_getmap.TestGetMapLegend")},
+		{Prefix: aws.String("tests.api.test_search.TestSearch")},
+		{Prefix: aws.String("tests.api.TestHealth")},
+	}
+	modules := []string{"api", "api.test_search", "wms", "wms.test_getmap", "wmts.test_tiles"}
+	assert.Equal(t, []string{"api", "api.test_search", "wms.test_getmap"}, failedTestModules(tests, modules))
+
+	// Without the E2E tests repository
+	assert.Equal(t, []string{"api.TestHealth", "api.test_search", "wms.test_getmap"}, failedTestModules(tests, nil))
+}
+
+func TestRetryStartFlags(t *testing.T) {
+	client := newFakeCodeBuild()
+	client.addReport(fakeReportArn(1), map[string]int{testStatusSucceeded: 5, testStatusFailed: 2, testStatusError: 1})
+	build := types.Build{
+		Id:                    aws.String("e2e-tests-int-pr:1"),
+		BuildComplete:         true,
+		BuildStatus:           types.StatusTypeFailed,
+		SourceVersion:         aws.String("master"),
+		ResolvedSourceVersion: aws.String("0123456789abcdef"),
+		ReportArns:            []string{fakeReportArn(1)},
+		Environment: &types.ProjectEnvironment{EnvironmentVariables: []types.EnvironmentVariable{
+			{Name: aws.String("DO_DATA_TEST"), Value: aws.String("1")},
+		}},
+	}
+
+	flags, err := retryStartFlags(context.Background(), client, build, []string{"FAILED", "ERROR"})
+	require.NoError(t, err)
+	assert.Equal(t, StartCmdFlags{
+		Staging:    "int",
+		Revision:   "0123456789abcdef",
+		DoDataTest: true,
+		Tests:      []string{"tests.ERROR", "tests.FAILED"},
+	}, flags)
+
+	build.ReportArns = nil
+	_, err = retryStartFlags(context.Background(), client, build, nil)
+	assert.ErrorContains(t, err, "no failed tests found")
+}
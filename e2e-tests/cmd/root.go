@@ -60,7 +60,10 @@ func init() {
 	rootCmd.PersistentFlags().Bool("no-profile", false, "Do not use AWS profile swisstopo-bgdi-builder for credentials")
 	rootCmd.PersistentFlags().String("role", "", "Role to assume for AWS permissions")
 	rootCmd.PersistentFlags().Bool("no-progress", false, "For long running command don't display progress indicator")
-	rootCmd.PersistentFlags().Int("interval", 1, "Interval in seconds to check the E2E tests status")
+	rootCmd.PersistentFlags().Int("interval", 1, "Initial interval in seconds to check the E2E tests status, "+
+		"increased after each check up to 30 seconds")
+	rootCmd.PersistentFlags().Duration("timeout", 0, "Maximum time to wait for the E2E tests result (e.g. 90m), "+
+		"0 for no timeout")
 }
 
 //-----------------------------------------------------------------------------
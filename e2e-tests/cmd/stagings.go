@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/codebuild"
+	"github.com/aws/aws-sdk-go-v2/service/codebuild/types"
+	"github.com/geoadmin/tool-golang-bgdi/lib/fmtc"
+)
+
+//-----------------------------------------------------------------------------
+
+// Starts the tests on all the stagings of the flags, waits for all of them and prints
+// the result per staging. Returns ErrTestFailed if the tests failed on any staging.
+func runStartStagings(
+	ctx context.Context,
+	restoreSignals func(),
+	client codebuildAPI,
+	flags StartCmdFlags,
+) error {
+	buildIDs := []string{}
+	runs := []startedRun{}
+	for _, staging := range flags.Stagings {
+		stagingFlags := flags
+		stagingFlags.Staging = staging
+		rs, e := startBuild(ctx, client, stagingFlags)
+		if e != nil {
+			if len(buildIDs) == 0 {
+				return e
+			}
+			cPrintf(fmtc.Yellow, "Failed to start the E2E tests on %s, stopping the runs already started: %s\n",
+				staging, strings.Join(buildIDs, ", "))
+			return stopBuilds(client, buildIDs, flags.Interval, e)
+		}
+		buildIDs = append(buildIDs, *rs.Build.Id)
+		runs = append(runs, startedRun{Staging: staging, TestID: *rs.Build.Id})
+	}
+	e := writeHandoff(runs, flags.OutputFile, flags.GithubOutput)
+	if e != nil {
+		return e
+	}
+	if flags.NoWait {
+		printNoWait(buildIDs)
+		return nil
+	}
+
+	builds, e := waitForBuilds(ctx, client, buildIDs, flags.ShowProgress, flags.Interval, flags.Timeout)
+	if e != nil {
+		if flags.StopOnInterrupt {
+			return stopInterruptedBuilds(ctx, restoreSignals, client, buildIDs, flags.Interval, e)
+		}
+		return e
+	}
+
+	failed := false
+	for i, build := range builds {
+		staging := flags.Stagings[i]
+		cPrintf(fmtc.NoColor, "\nE2E tests on %s finished with status: %s\n", staging, build.BuildStatus)
+
+		result := &codebuild.BatchGetBuildsOutput{Builds: []types.Build{build}}
+		e = exportTestResult(
+			ctx, client, result, stagingFileName(flags.JUnitFile, staging), stagingFileName(flags.JSONFile, staging),
+		)
+		if e != nil {
+			return e
+		}
+		e = printTestResult(ctx, client, result, false)
+		switch {
+		case errors.Is(e, ErrTestFailed):
+			failed = true
+		case e != nil:
+			return e
+		}
+	}
+
+	printStagingsSummary(flags.Stagings, builds)
+	if failed {
+		return ErrTestFailed
+	}
+	return nil
+}
+
+func printStagingsSummary(stagings []string, builds []types.Build) {
+	cPrintln(fmtc.NoColor, "\nE2E tests summary:")
+	cPrintln(fmtc.NoColor, "------------------")
+	for i, build := range builds {
+		color := fmtc.Red
+		if build.BuildStatus == types.StatusTypeSucceeded {
+			color = fmtc.Green
+		}
+		duration := aws.ToTime(build.EndTime).Sub(aws.ToTime(build.StartTime)).Round(time.Second)
+		cPrintf(color, "%-5s %-10s %8s %s\n", stagings[i], build.BuildStatus, duration,
+			buildLogLink(aws.ToString(build.Id)))
+	}
+}
+
+// Returns the export filename of the staging, the staging is added before the extension
+// (e.g. report.xml => report-dev.xml). An empty filename stays empty.
+func stagingFileName(filename string, staging string) string {
+	if filename == "" {
+		return ""
+	}
+	ext := filepath.Ext(filename)
+	return strings.TrimSuffix(filename, ext) + "-" + staging + ext
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/codebuild/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunStartStagings(t *testing.T) {
+	client := newFakeCodeBuild()
+	client.startStatuses["e2e-tests-dev-pr"] = types.StatusTypeSucceeded
+	client.startStatuses["e2e-tests-int-pr"] = types.StatusTypeFailed
+	jsonFile := filepath.Join(t.TempDir(), "report.json")
+	flags := StartCmdFlags{Stagings: []string{"int", "dev"}, Revision: "master", JSONFile: jsonFile}
+
+	err := runStartStagings(context.Background(), func() {}, client, flags)
+	require.ErrorIs(t, err, ErrTestFailed)
+	assert.Equal(t, 2, client.calls["StartBuild"])
+	// All builds are polled at once
+	assert.Equal(t, 1, client.calls["BatchGetBuilds"])
+	assert.FileExists(t, stagingFileName(jsonFile, "int"))
+	assert.FileExists(t, stagingFileName(jsonFile, "dev"))
+
+	client.startStatuses["e2e-tests-int-pr"] = types.StatusTypeSucceeded
+	require.NoError(t, runStartStagings(context.Background(), func() {}, client, flags))
+
+	// The fake build IDs are numbered in start order
+	ids := []string{"e2e-tests-int-pr:3", "e2e-tests-int-pr:1"}
+	builds, err := waitForBuilds(context.Background(), client, ids, false, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, types.StatusTypeSucceeded, builds[0].BuildStatus)
+	assert.Equal(t, types.StatusTypeFailed, builds[1].BuildStatus)
+}
+
+func TestRunStartStagingsStartError(t *testing.T) {
+	client := newFakeCodeBuild()
+	startErr := errors.New("start failed")
+	client.startErrs["e2e-tests-prod-pr"] = startErr
+	flags := StartCmdFlags{Stagings: []string{"dev", "int", "prod"}, Revision: "master"}
+
+	err := runStartStagings(context.Background(), func() {}, client, flags)
+	require.ErrorIs(t, err, startErr)
+	// The builds already started are stopped
+	assert.Equal(t, 2, client.calls["StopBuild"])
+	for _, id := range []string{"e2e-tests-dev-pr:1", "e2e-tests-int-pr:2"} {
+		assert.Equal(t, types.StatusTypeStopped, client.builds[id].BuildStatus)
+	}
+}
+
+func TestStagingFileName(t *testing.T) {
+	assert.Equal(t, "out/report-dev.xml", stagingFileName("out/report.xml", "dev"))
+	assert.Equal(t, "report-int", stagingFileName("report", "int"))
+	assert.Empty(t, stagingFileName("", "int"))
+}
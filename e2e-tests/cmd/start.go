@@ -2,11 +2,14 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
+	"slices"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/codebuild"
 	"github.com/aws/aws-sdk-go-v2/service/codebuild/types"
@@ -20,11 +23,23 @@ import (
 
 type StartCmdFlags struct {
 	Staging      string
+	Stagings     []string
 	Tests        []string
 	Revision     string
 	DoDataTest   bool
 	ShowProgress bool
 	Interval     int
+	Timeout      time.Duration
+	JUnitFile    string
+	JSONFile     string
+	Logs         logsOptions
+	// Stop the build when the command is interrupted
+	StopOnInterrupt bool
+	// Only start the build, the result is retrieved later with get
+	NoWait bool
+	// Files to write the test IDs to
+	OutputFile   string
+	GithubOutput bool
 }
 
 //-----------------------------------------------------------------------------
@@ -33,7 +48,17 @@ type StartCmdFlags struct {
 var startCmd = &cobra.Command{
 	Use:   "start",
 	Short: "Start E2E tests and wait for the result",
-	Long:  `Start E2E tests on Codebuild and wait for the result.`,
+	Long: `Start E2E tests on Codebuild and wait for the result.
+
+With several stagings the tests are run in parallel on all of them and the command fails if
+the tests failed on any staging. The JUnit and JSON files are then written per staging with the
+staging as suffix (e.g. report-dev.xml).
+
+Examples:
+	e2e-tests start --staging dev
+	e2e-tests start --staging dev,int --tests wms
+	e2e-tests start --all-stagings --junit-file report.xml
+	e2e-tests start --staging int --no-wait --github-output`,
 	RunE: func(cmd *cobra.Command, _ []string) error {
 		e := initPrint(cmd)
 		if e != nil {
@@ -43,7 +68,7 @@ var startCmd = &cobra.Command{
 		if e != nil {
 			return e
 		}
-		printStart(flags.Staging, flags.Tests)
+		printStart(strings.Join(flags.Stagings, ", "), flags.Tests)
 
 		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 		defer stop() // Ensure cleanup
@@ -53,13 +78,52 @@ var startCmd = &cobra.Command{
 			return e
 		}
 
+		if len(flags.Stagings) > 1 {
+			return runStartStagings(ctx, stop, client, flags)
+		}
+
 		rs, e := startBuild(ctx, client, flags)
 		if e != nil {
 			return e
 		}
 
+		buildID := *rs.Build.Id
+		e = writeHandoff([]startedRun{{Staging: flags.Staging, TestID: buildID}}, flags.OutputFile, flags.GithubOutput)
+		if e != nil {
+			return e
+		}
+		if flags.NoWait {
+			printNoWait([]string{buildID})
+			return nil
+		}
+
+		onWaitError := func(err error) error {
+			if !flags.StopOnInterrupt {
+				return err
+			}
+			return stopInterruptedBuilds(ctx, stop, client, []string{buildID}, flags.Interval, err)
+		}
+
+		// The timeout is shared by following the logs and waiting for the result
+		waitCtx, cancel := withWaitTimeout(ctx, flags.Timeout)
+		defer cancel()
+
+		if flags.Logs.Follow {
+			e = followBuildLogs(waitCtx, cmd, client, buildID, flags.Logs, flags.Interval, 0)
+			if e != nil {
+				return onWaitError(e)
+			}
+			// The logs replace the progress indicator
+			flags.ShowProgress = false
+		}
+
 		// Wait for the build to finish
-		re, e := waitForBuild(ctx, client, *rs.Build.Id, flags.ShowProgress, flags.Interval)
+		re, e := waitForBuild(waitCtx, client, buildID, flags.ShowProgress, flags.Interval, 0)
+		if e != nil {
+			return onWaitError(e)
+		}
+
+		e = exportTestResult(ctx, client, re, flags.JUnitFile, flags.JSONFile)
 		if e != nil {
 			return e
 		}
@@ -78,19 +142,30 @@ func init() {
 	rootCmd.AddCommand(startCmd)
 
 	// Here you will define your flags and configuration settings.
-	startCmd.Flags().StringP("staging", "s", "dev", "Staging environment to use. Default is dev")
+	startCmd.Flags().StringSliceP("staging", "s", []string{"dev"}, "Staging environments to use. Default is dev")
+	startCmd.Flags().Bool("all-stagings", false, "Run the tests on all staging environments")
 	startCmd.Flags().String("revision", "master", "Revision of the tests to run. Default is master")
 	startCmd.Flags().Bool("data-tests", false, "Do also data integration tests (tests take much longer !)")
 	startCmd.Flags().StringArrayP("tests", "t", []string{}, "Test to run. Default is all tests")
+	addExportFlags(startCmd)
+	addLogsFlags(startCmd)
+	startCmd.Flags().Bool("stop-on-interrupt", false, "Stop the E2E tests run when the command is interrupted")
+	startCmd.Flags().Bool("no-wait", false, "Do not wait for the result, use the get command to get it later")
+	startCmd.Flags().String("output-file", "", "Write the test IDs and log links as key=value lines to this file")
+	startCmd.Flags().Bool("github-output", false, "Append the test IDs and log links to the $GITHUB_OUTPUT file")
 
 	// Completions functions
 	_ = startCmd.RegisterFlagCompletionFunc(
 		"staging",
 		func(_ *cobra.Command, _ []string, _ string) ([]cobra.Completion, cobra.ShellCompDirective,
 		) {
-			return []cobra.Completion{"dev", "int", "prod"}, cobra.ShellCompDirectiveDefault
+			return allStagings, cobra.ShellCompDirectiveDefault
 		})
 	_ = startCmd.RegisterFlagCompletionFunc("tests", completions.CompleteTests)
+	startCmd.MarkFlagsMutuallyExclusive("staging", "all-stagings")
+	for _, flag := range []string{"follow", "stop-on-interrupt", "junit-file", "json-file"} {
+		startCmd.MarkFlagsMutuallyExclusive("no-wait", flag)
+	}
 }
 
 //-----------------------------------------------------------------------------
@@ -104,11 +179,38 @@ func printStart(staging string, tests []string) {
 	}
 }
 
+func printNoWait(buildIDs []string) {
+	for _, id := range buildIDs {
+		cPrintf(fmtc.NoColor, "Get the result with: e2e-tests get --test-id %s\n", id)
+	}
+}
+
 // -----------------------------------------------------------------------------
 // Get start command flags
 func getCmdStartFlags(cmd *cobra.Command) (StartCmdFlags, error) {
 	var flags StartCmdFlags
-	flags.Staging = cmd.Flag("staging").Value.String()
+	stagings, err := cmd.Flags().GetStringSlice("staging")
+	if err != nil {
+		return StartCmdFlags{}, err
+	}
+	allStagingsFlag, err := cmd.Flags().GetBool("all-stagings")
+	if err != nil {
+		return StartCmdFlags{}, err
+	}
+	if allStagingsFlag {
+		stagings = allStagings
+	}
+	if len(stagings) == 0 {
+		return StartCmdFlags{}, errors.New("at least one staging is required")
+	}
+	// The results are reported per staging
+	flags.Stagings = []string{}
+	for _, staging := range stagings {
+		if !slices.Contains(flags.Stagings, staging) {
+			flags.Stagings = append(flags.Stagings, staging)
+		}
+	}
+	flags.Staging = flags.Stagings[0]
 	flags.Revision = cmd.Flag("revision").Value.String()
 	doDataTest, err := cmd.Flags().GetBool("data-tests")
 	if err != nil {
@@ -138,12 +240,48 @@ func getCmdStartFlags(cmd *cobra.Command) (StartCmdFlags, error) {
 	showProgress := !np
 	flags.ShowProgress = showProgress
 
-	interval, err := cmd.Flags().GetInt("interval")
+	interval, err := getIntervalFlag(cmd)
 	if err != nil {
 		return StartCmdFlags{}, err
 	}
 	flags.Interval = interval
 
+	timeout, err := cmd.Flags().GetDuration("timeout")
+	if err != nil {
+		return StartCmdFlags{}, err
+	}
+	flags.Timeout = timeout
+
+	flags.JUnitFile, flags.JSONFile = getExportFlags(cmd)
+
+	flags.Logs, err = getLogsFlags(cmd)
+	if err != nil {
+		return StartCmdFlags{}, err
+	}
+
+	flags.StopOnInterrupt, err = cmd.Flags().GetBool("stop-on-interrupt")
+	if err != nil {
+		return StartCmdFlags{}, err
+	}
+	flags.NoWait, err = cmd.Flags().GetBool("no-wait")
+	if err != nil {
+		return StartCmdFlags{}, err
+	}
+	flags.OutputFile = cmd.Flag("output-file").Value.String()
+	flags.GithubOutput, err = cmd.Flags().GetBool("github-output")
+	if err != nil {
+		return StartCmdFlags{}, err
+	}
+	// Fail before starting the tests, not after
+	err = checkHandoff(flags.OutputFile, flags.GithubOutput)
+	if err != nil {
+		return StartCmdFlags{}, err
+	}
+
+	if flags.Logs.Follow && len(flags.Stagings) > 1 {
+		return StartCmdFlags{}, errors.New("--follow is only supported with a single staging")
+	}
+
 	return flags, nil
 }
 
@@ -151,7 +289,7 @@ func getCmdStartFlags(cmd *cobra.Command) (StartCmdFlags, error) {
 
 func startBuild(
 	ctx context.Context,
-	client *codebuild.Client,
+	client codebuildAPI,
 	flags StartCmdFlags,
 ) (*codebuild.StartBuildOutput, error) {
 	const tm30Minutes = 30
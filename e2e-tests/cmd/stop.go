@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/codebuild"
+	"github.com/geoadmin/tool-golang-bgdi/lib/fmtc"
+	"github.com/spf13/cobra"
+)
+
+// Maximum time to stop an interrupted tests run and wait for its final status
+const stopTimeout = 2 * time.Minute
+
+//-----------------------------------------------------------------------------
+
+// stopCmd represents the stop command
+var stopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop an E2E tests run",
+	Long: `Stop an E2E tests run and wait for its final status.
+
+Examples:
+	e2e-tests stop --test-id e2e-tests-dev-pr:1234`,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		e := initPrint(cmd)
+		if e != nil {
+			return e
+		}
+		testID := cmd.Flag("test-id").Value.String()
+		interval, e := getIntervalFlag(cmd)
+		if e != nil {
+			return e
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop() // Ensure cleanup
+
+		client, e := getClient(ctx, cmd)
+		if e != nil {
+			return e
+		}
+
+		return stopBuild(ctx, client, testID, interval)
+	},
+	ValidArgsFunction: func(_ *cobra.Command, _ []string, _ string) ([]cobra.Completion, cobra.ShellCompDirective) {
+		// Avoid doing file/folder completion after the command
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	},
+}
+
+//-----------------------------------------------------------------------------
+
+func init() {
+	rootCmd.AddCommand(stopCmd)
+
+	stopCmd.Flags().StringP("test-id", "t", "", "Test ID")
+	_ = stopCmd.MarkFlagRequired("test-id")
+}
+
+//-----------------------------------------------------------------------------
+
+// Stops the build and waits until it is complete
+func stopBuild(ctx context.Context, client codebuildAPI, buildID string, interval int) error {
+	r, e := client.StopBuild(ctx, &codebuild.StopBuildInput{Id: &buildID})
+	if e != nil {
+		return fmt.Errorf("failed to stop tests run %s: %w", buildID, e)
+	}
+	if r.Build != nil && r.Build.BuildComplete {
+		cPrintf(fmtc.NoColor, "E2E tests run %s already finished with status: %s\n", buildID, r.Build.BuildStatus)
+		return nil
+	}
+
+	cPrintf(fmtc.NoColor, "Stopping E2E tests run %s...\n", buildID)
+	_, e = waitForBuild(ctx, client, buildID, false, interval, 0)
+	return e
+}
+
+// Stops the builds started by the command after an interrupt (ctx canceled) and returns
+// err. The stop uses a new context as ctx is canceled, restoreSignals restores the
+// default signal behavior so that a second interrupt exits immediately.
+func stopInterruptedBuilds(
+	ctx context.Context,
+	restoreSignals func(),
+	client codebuildAPI,
+	buildIDs []string,
+	interval int,
+	err error,
+) error {
+	if ctx.Err() == nil {
+		return err
+	}
+	restoreSignals()
+
+	cPrintln(fmtc.Yellow, "\nInterrupted, stopping the E2E tests runs (interrupt again to exit immediately)")
+	return stopBuilds(client, buildIDs, interval, err)
+}
+
+// Stops the builds and returns err joined with the stop errors, a new context is used as
+// the context of the command can be canceled
+func stopBuilds(client codebuildAPI, buildIDs []string, interval int, err error) error {
+	stopCtx, cancel := context.WithTimeout(context.Background(), stopTimeout)
+	defer cancel()
+	errs := []error{err}
+	for _, buildID := range buildIDs {
+		e := stopBuild(stopCtx, client, buildID, interval)
+		if e != nil {
+			errs = append(errs, e)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/codebuild"
+	"github.com/aws/aws-sdk-go-v2/service/codebuild/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStopInterruptedBuilds(t *testing.T) {
+	client := newFakeCodeBuild()
+	r, err := client.StartBuild(
+		context.Background(), &codebuild.StartBuildInput{ProjectName: aws.String("e2e-tests-dev-pr")},
+	)
+	require.NoError(t, err)
+	buildID := aws.ToString(r.Build.Id)
+	waitErr := errors.New("context canceled")
+	restored := false
+	restoreSignals := func() { restored = true }
+
+	// Not interrupted, the build keeps running
+	err = stopInterruptedBuilds(context.Background(), restoreSignals, client, []string{buildID}, 0, waitErr)
+	require.ErrorIs(t, err, waitErr)
+	assert.False(t, restored)
+	assert.Equal(t, 0, client.calls["StopBuild"])
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = stopInterruptedBuilds(ctx, restoreSignals, client, []string{buildID}, 0, waitErr)
+	require.ErrorIs(t, err, waitErr)
+	assert.True(t, restored)
+	assert.Equal(t, 1, client.calls["StopBuild"])
+	assert.Equal(t, types.StatusTypeStopped, client.builds[buildID].BuildStatus)
+
+	// Stopping a finished build doesn't wait
+	client.calls = map[string]int{}
+	require.NoError(t, stopBuild(context.Background(), client, buildID, 0))
+	assert.Equal(t, 0, client.calls["BatchGetBuilds"])
+}
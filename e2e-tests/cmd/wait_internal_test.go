@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/codebuild"
+	"github.com/aws/aws-sdk-go-v2/service/codebuild/types"
+	"github.com/aws/smithy-go"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingCodeBuild returns the errors before the builds of the fake
+type failingCodeBuild struct {
+	*fakeCodeBuild
+	errs []error
+}
+
+func (f *failingCodeBuild) BatchGetBuilds(
+	ctx context.Context, params *codebuild.BatchGetBuildsInput, optFns ...func(*codebuild.Options),
+) (*codebuild.BatchGetBuildsOutput, error) {
+	if len(f.errs) > 0 {
+		e := f.errs[0]
+		f.errs = f.errs[1:]
+		return nil, e
+	}
+	return f.fakeCodeBuild.BatchGetBuilds(ctx, params, optFns...)
+}
+
+func TestWaitForBuildsRetries(t *testing.T) {
+	fake := newFakeCodeBuild()
+	fake.builds["e2e-tests-dev-pr:1"] = types.Build{
+		Id: aws.String("e2e-tests-dev-pr:1"), BuildComplete: true, BuildStatus: types.StatusTypeSucceeded,
+	}
+	throttling := &smithy.GenericAPIError{Code: "ThrottlingException", Message: "Rate exceeded"}
+	client := &failingCodeBuild{fakeCodeBuild: fake, errs: []error{throttling, throttling}}
+
+	builds, err := waitForBuilds(context.Background(), client, []string{"e2e-tests-dev-pr:1"}, false, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, types.StatusTypeSucceeded, builds[0].BuildStatus)
+
+	// Too many transient errors in a row
+	client.errs = make([]error, maxPollErrors+1)
+	for i := range client.errs {
+		client.errs[i] = throttling
+	}
+	_, err = waitForBuilds(context.Background(), client, []string{"e2e-tests-dev-pr:1"}, false, 0, 0)
+	require.ErrorAs(t, err, &throttling)
+
+	// Other errors are not retried
+	denied := &smithy.GenericAPIError{Code: "AccessDeniedException"}
+	client.errs = []error{denied}
+	_, err = waitForBuilds(context.Background(), client, []string{"e2e-tests-dev-pr:1"}, false, 0, 0)
+	require.ErrorAs(t, err, &denied)
+	assert.Empty(t, client.errs)
+}
+
+func TestWaitForBuildsTimeout(t *testing.T) {
+	client := newFakeCodeBuild()
+	client.builds["e2e-tests-dev-pr:1"] = types.Build{
+		Id: aws.String("e2e-tests-dev-pr:1"), BuildStatus: types.StatusTypeInProgress,
+	}
+
+	_, err := waitForBuilds(context.Background(), client, []string{"e2e-tests-dev-pr:1"}, false, 0, 10*time.Millisecond)
+	require.ErrorIs(t, err, errWaitTimeout)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = waitForBuilds(ctx, client, []string{"e2e-tests-dev-pr:1"}, false, 1, time.Hour)
+	require.ErrorIs(t, err, context.Canceled)
+	assert.False(t, errors.Is(err, errWaitTimeout))
+}
+
+func TestBuildsProgress(t *testing.T) {
+	builds := []types.Build{
+		{Id: aws.String("e2e-tests-dev-pr:1"), CurrentPhase: aws.String("BUILD")},
+		{
+			Id:     aws.String("e2e-tests-int-pr:1"),
+			Phases: []types.BuildPhase{{PhaseType: types.BuildPhaseTypeSubmitted}, {PhaseType: types.BuildPhaseTypeQueued}},
+		},
+		{Id: aws.String("e2e-tests-prod-pr:1"), BuildComplete: true, BuildStatus: types.StatusTypeFailed},
+	}
+	assert.Equal(t, " (BUILD)", buildsProgress(builds[:1]))
+	assert.Equal(t, " (dev BUILD, int QUEUED, prod FAILED)", buildsProgress(builds))
+}
+
+func TestGetIntervalFlag(t *testing.T) {
+	cmd := &cobra.Command{}
+	cmd.Flags().Int("interval", 1, "")
+
+	interval, err := getIntervalFlag(cmd)
+	require.NoError(t, err)
+	assert.Equal(t, 1, interval)
+
+	require.NoError(t, cmd.Flags().Set("interval", "0"))
+	_, err = getIntervalFlag(cmd)
+	assert.ErrorContains(t, err, "invalid --interval 0")
+}
@@ -0,0 +1,132 @@
+package awscfg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+//-----------------------------------------------------------------------------
+
+// Options defines where the AWS credentials are taken from
+type Options struct {
+	// AWS region
+	Region string
+	// Shared config profile, ignored if NoProfile is set
+	Profile string
+	// Use the default credential chain (environment variables, web identity from
+	// AWS_WEB_IDENTITY_TOKEN_FILE/AWS_ROLE_ARN, container or instance role, ...)
+	NoProfile bool
+	// Role to assume with the profile or default credentials
+	RoleArn string
+	// External ID used to assume the role. Requires RoleArn, not supported with
+	// WebIdentityTokenFile
+	ExternalID string
+	// Web identity token file (e.g. kubernetes service account token) used to
+	// assume the role. Requires RoleArn
+	WebIdentityTokenFile string
+	// Session name of the assumed role
+	RoleSessionName string
+	// Duration of the assumed role session. The credentials are refreshed
+	// automatically when they expire.
+	SessionDuration time.Duration
+}
+
+//-----------------------------------------------------------------------------
+
+// LoadConfig returns the AWS config with the credentials defined by the options
+func LoadConfig(ctx context.Context, opts Options) (aws.Config, error) {
+	err := opts.Validate()
+	if err != nil {
+		return aws.Config{}, err
+	}
+
+	loadOptions := []func(*config.LoadOptions) error{}
+	if opts.Region != "" {
+		loadOptions = append(loadOptions, config.WithRegion(opts.Region))
+	}
+	if opts.Profile != "" && !opts.NoProfile {
+		loadOptions = append(loadOptions, config.WithSharedConfigProfile(opts.Profile))
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, loadOptions...)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	provider := roleProvider(cfg, opts)
+	if provider == nil {
+		return cfg, nil
+	}
+
+	// The cache refreshes the credentials before they expire
+	cfg.Credentials = aws.NewCredentialsCache(provider)
+
+	// Assume the role now to report errors early
+	_, err = cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to assume role %s: %w", opts.RoleArn, err)
+	}
+
+	return cfg, nil
+}
+
+// Validate returns an error if the options can't be used together. LoadConfig validates
+// the options, call it to report invalid command line flags early.
+func (opts Options) Validate() error {
+	if opts.RoleArn == "" {
+		if opts.WebIdentityTokenFile != "" {
+			return errors.New("a role ARN is required with a web identity token file")
+		}
+		if opts.ExternalID != "" {
+			return errors.New("a role ARN is required with an external ID")
+		}
+	}
+	if opts.WebIdentityTokenFile != "" && opts.ExternalID != "" {
+		return errors.New("an external ID can't be used with a web identity token file")
+	}
+	return nil
+}
+
+// Returns the provider assuming the role of the options with the credentials of cfg,
+// nil without role
+func roleProvider(cfg aws.Config, opts Options) aws.CredentialsProvider {
+	if opts.RoleArn == "" {
+		return nil
+	}
+
+	sessionName := opts.RoleSessionName
+	if sessionName == "" {
+		sessionName = fmt.Sprintf("bgdi-tools-%d", time.Now().Unix())
+	}
+
+	stsClient := sts.NewFromConfig(cfg)
+	if opts.WebIdentityTokenFile != "" {
+		return stscreds.NewWebIdentityRoleProvider(
+			stsClient,
+			opts.RoleArn,
+			stscreds.IdentityTokenFile(opts.WebIdentityTokenFile),
+			func(o *stscreds.WebIdentityRoleOptions) {
+				o.RoleSessionName = sessionName
+				o.Duration = opts.SessionDuration
+			},
+		)
+	}
+	return stscreds.NewAssumeRoleProvider(stsClient, opts.RoleArn, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = sessionName
+		if opts.ExternalID != "" {
+			o.ExternalID = aws.String(opts.ExternalID)
+		}
+		if opts.SessionDuration != 0 {
+			o.Duration = opts.SessionDuration
+		}
+	})
+}
+
+//-----------------------------------------------------------------------------
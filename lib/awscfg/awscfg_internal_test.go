@@ -0,0 +1,94 @@
+package awscfg
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoleProvider(t *testing.T) {
+	const roleArn = "arn:aws:iam::123456789012:role/test"
+	cfg := aws.Config{Region: "eu-central-1"}
+	tests := []struct {
+		name     string
+		opts     Options
+		err      string
+		provider any
+	}{
+		{name: "default credentials", opts: Options{Profile: "test"}},
+		{name: "no profile", opts: Options{Profile: "test", NoProfile: true}},
+		{name: "role", opts: Options{RoleArn: roleArn}, provider: &stscreds.AssumeRoleProvider{}},
+		{
+			name:     "role with external id",
+			opts:     Options{RoleArn: roleArn, ExternalID: "id"},
+			provider: &stscreds.AssumeRoleProvider{},
+		},
+		{
+			name:     "role with web identity",
+			opts:     Options{RoleArn: roleArn, WebIdentityTokenFile: "token"},
+			provider: &stscreds.WebIdentityRoleProvider{},
+		},
+		{
+			name: "web identity without role",
+			opts: Options{WebIdentityTokenFile: "token"},
+			err:  "a role ARN is required with a web identity token file",
+		},
+		{
+			name: "external id without role",
+			opts: Options{ExternalID: "id"},
+			err:  "a role ARN is required with an external ID",
+		},
+		{
+			name: "web identity with external id",
+			opts: Options{RoleArn: roleArn, WebIdentityTokenFile: "token", ExternalID: "id"},
+			err:  "an external ID can't be used with a web identity token file",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Validate()
+			if tt.err != "" {
+				require.EqualError(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			provider := roleProvider(cfg, tt.opts)
+			if tt.provider == nil {
+				assert.Nil(t, provider)
+			} else {
+				assert.IsType(t, tt.provider, provider)
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	ctx := context.Background()
+
+	cfg, err := LoadConfig(ctx, Options{Region: "eu-central-1", Profile: "unknown", NoProfile: true})
+	require.NoError(t, err)
+	assert.Equal(t, "eu-central-1", cfg.Region)
+
+	_, err = LoadConfig(ctx, Options{Profile: "unknown"})
+	require.ErrorContains(t, err, "failed to load configuration")
+
+	_, err = LoadConfig(ctx, Options{ExternalID: "id"})
+	require.EqualError(t, err, "a role ARN is required with an external ID")
+
+	// The role is assumed immediately, the token file is read before calling STS
+	_, err = LoadConfig(ctx, Options{
+		Region:               "eu-central-1",
+		NoProfile:            true,
+		RoleArn:              "arn:aws:iam::123456789012:role/test",
+		WebIdentityTokenFile: filepath.Join(dir, "missing-token"),
+	})
+	require.ErrorContains(t, err, "failed to assume role arn:aws:iam::123456789012:role/test")
+}